@@ -6,8 +6,19 @@ import (
 	"strings"
 
 	"mqtt-adapter/src/config"
-	"mqtt-adapter/src/mqtt"
 	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/mqtt"
+)
+
+const (
+	// modeExec runs processor as a child process talking over stdin/stdout
+	modeExec = "exec"
+	// modeHTTP posts MQTT messages to processor webhook
+	modeHTTP = "http"
+	// modeSocket exchanges messages with processor over Unix domain socket
+	modeSocket = "socket"
+	// modeGRPC streams messages to processor gRPC service
+	modeGRPC = "grpc"
 )
 
 // Runner is a client for Microservice MQTT Adapter
@@ -17,10 +28,22 @@ type Runner interface {
 
 // client is an instance of Microservice MQTT Adapter
 type client struct {
-	topic     string
-	listener  mqtt.Subscriber
-	publisher mqtt.Publisher
-	command   *exec.Cmd
+	topic        string
+	listener     mqtt.Subscriber
+	publisher    mqtt.Publisher
+	command      *exec.Cmd
+	rules        []*rewriteRule
+	reverse      *bridgeRoute
+	filters      filters
+	transforms   pipeline
+	destinations []*destination
+	rpc          *rpc
+	schedules    []*schedule
+	schemas      validator
+	acl          []string
+	control      *control
+	// watchers stop watching rotated secrets
+	watchers []func()
 }
 
 // New initializes MQTT adapter and return instance
@@ -28,27 +51,126 @@ func New() (Runner, error) {
 	if config.Config == nil {
 		return nil, fmt.Errorf("not initialized Config")
 	}
-	commands := strings.Fields(config.Config.ServiceProcessor)
-	adapter := new(client)
-	adapter.topic = config.Config.Topic
+	adapter, err := load(config.Config)
+	if err != nil {
+		return nil, err
+	}
 	pub, sub, err := mqtt.NewMQTTClients(config.Config)
 	if err != nil {
 		return nil, err
 	}
 	adapter.publisher = pub
 	adapter.listener = sub
+	adapter.watchers = append(adapter.watchers, mqtt.WatchSecrets(config.Config, false, pub, sub))
+	if config.Config.Bridge {
+		if err = adapter.initBridge(config.Config); err != nil {
+			adapter.close()
+			return nil, err
+		}
+		return adapter, nil
+	}
+	switch config.Config.ProcessorMode {
+	case modeHTTP, modeSocket, modeGRPC:
+		return adapter, nil
+	}
+	commands := strings.Fields(config.Config.ServiceProcessor)
 	adapter.command = exec.Command(commands[0], commands[1:]...)
 	return adapter, nil
 }
 
+// Validate checks adapter settings and loads its files without connecting to MQTT brokers
+func Validate(conf *config.Configuration) error {
+	c, err := load(conf)
+	if err != nil {
+		return err
+	}
+	if err = mqtt.CheckTransport(conf); err != nil {
+		return err
+	}
+	if conf.Bridge {
+		_, err = c.loadBridge(conf)
+		return err
+	}
+	switch conf.ProcessorMode {
+	case "", modeExec:
+		command := strings.Fields(conf.ServiceProcessor)[0]
+		if _, err = exec.LookPath(command); err != nil {
+			return fmt.Errorf("SERVICE_PROCESSOR: %v", err)
+		}
+	}
+	return nil
+}
+
+// load checks adapter settings and creates client with loaded schedules and schemas
+func load(conf *config.Configuration) (*client, error) {
+	if _, err := getFraming(conf.Framing); err != nil {
+		return nil, err
+	}
+	if err := checkMode(conf); err != nil {
+		return nil, err
+	}
+	if _, err := newQueue(processorQueue, conf.QueueSize, conf.QueueOverflow, nil); err != nil {
+		return nil, err
+	}
+	if conf.Bridge && conf.Schedules != "" {
+		return nil, fmt.Errorf("SCHEDULES is not supported in Bridge mode")
+	}
+	schedules, err := loadSchedules(conf.Schedules)
+	if err != nil {
+		return nil, err
+	}
+	schemas, err := loadSchemas(conf.Schemas)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkACL(conf.ControlACL); err != nil {
+		return nil, err
+	}
+	return &client{topic: conf.Topic, schedules: schedules, schemas: schemas, acl: conf.ControlACL}, nil
+}
+
+// checkMode checks if processor mode is known and has required options
+func checkMode(conf *config.Configuration) error {
+	switch conf.ProcessorMode {
+	case "", modeExec:
+		if len(strings.Fields(conf.ServiceProcessor)) == 0 {
+			return fmt.Errorf("SERVICE_PROCESSOR wasn't set")
+		}
+	case modeHTTP:
+		if conf.WebhookURL == "" {
+			return fmt.Errorf("WEBHOOK_URL wasn't set for PROCESSOR_MODE=%s", modeHTTP)
+		}
+	case modeSocket:
+		if conf.ProcessorSocket == "" {
+			return fmt.Errorf("PROCESSOR_SOCKET wasn't set for PROCESSOR_MODE=%s", modeSocket)
+		}
+	case modeGRPC:
+		if conf.ProcessorGRPC == "" {
+			return fmt.Errorf("PROCESSOR_GRPC wasn't set for PROCESSOR_MODE=%s", modeGRPC)
+		}
+	default:
+		return fmt.Errorf("unknown PROCESSOR_MODE %q", conf.ProcessorMode)
+	}
+	return nil
+}
 
 // Run starts app
 func (c *client) Run() {
 	defer c.listener.Disconnect()
-	if config.Config.Bridge {
+	switch {
+	case config.Config.Bridge:
 		logger.Log.Infoln("Start in Bridge mode")
 		c.runBridge()
-	} else {
+	case config.Config.ProcessorMode == modeHTTP:
+		logger.Log.Infoln("Start in non-Bridge mode with HTTP processor")
+		c.runWebhook()
+	case config.Config.ProcessorMode == modeSocket:
+		logger.Log.Infoln("Start in non-Bridge mode with Unix socket processor")
+		c.runSocket()
+	case config.Config.ProcessorMode == modeGRPC:
+		logger.Log.Infoln("Start in non-Bridge mode with gRPC processor")
+		c.runGRPC()
+	default:
 		logger.Log.Infoln("Start in non-Bridge mode")
 		c.run()
 	}
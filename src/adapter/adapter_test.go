@@ -83,3 +83,57 @@ func TestClient_Run(t *testing.T) {
 	config.Config.Bridge = true
 	cl.Run()
 }
+
+func TestCheckMode(t *testing.T) {
+	testCases := []struct {
+		name    string
+		needErr bool
+		conf    config.Configuration
+	}{
+		{"Test exec mode", false, config.Configuration{ServiceProcessor: "ls -la"}},
+		{"Test exec mode without processor", true, config.Configuration{ProcessorMode: modeExec}},
+		{"Test http mode", false, config.Configuration{ProcessorMode: modeHTTP, WebhookURL: "http://localhost:8000"}},
+		{"Test http mode without webhook", true, config.Configuration{ProcessorMode: modeHTTP}},
+		{"Test unknown mode", true, config.Configuration{ProcessorMode: "test"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkMode(&tc.conf)
+			if tc.needErr {
+				if err == nil {
+					t.Error("Expected not <nil> error")
+				}
+			} else {
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	logger.Log = &logrus.Logger{}
+	testCases := []struct {
+		name    string
+		needErr bool
+		conf    config.Configuration
+	}{
+		{"Test existing processor", false, config.Configuration{ServiceProcessor: "ls -la"}},
+		{"Test missing processor", true, config.Configuration{ServiceProcessor: "some_test_process"}},
+		{"Test unknown framing", true, config.Configuration{ServiceProcessor: "ls", Framing: "xml"}},
+		{"Test http mode", false, config.Configuration{ProcessorMode: modeHTTP, WebhookURL: "http://localhost:8000"}},
+		{"Test bridge", false, config.Configuration{Bridge: true, ServiceProcessor: "ls", NamespaceListener: "dev", NamespacePublisher: "prod"}},
+		{"Test bridge with missing rules", true, config.Configuration{Bridge: true, ServiceProcessor: "ls", BridgeRules: "absent.json"}},
+		{"Test bridge with schedules", true, config.Configuration{Bridge: true, ServiceProcessor: "ls", Schedules: "absent.json"}},
+		{"Test missing schemas", true, config.Configuration{ServiceProcessor: "ls", Schemas: "absent.json"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(&tc.conf)
+			if (err != nil) != tc.needErr {
+				t.Errorf("unexpected result: %v", err)
+			}
+		})
+	}
+}
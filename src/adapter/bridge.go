@@ -2,15 +2,93 @@ package adapter
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"strings"
 
 	"mqtt-adapter/src/config"
-	"mqtt-adapter/src/mqtt"
 	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/mqtt"
+)
+
+const (
+	// originField is a name of envelope field with the bridge which relayed the message first
+	originField = "bridge_origin"
+	// viaField is a name of envelope field with the bridges which relayed the message after the first one
+	viaField = "bridge_via"
+)
+
+var (
+	errNoRule  = errors.New("no bridge rule matches the topic")
+	errNoTopic = errors.New("message has no topic")
+	errLoop    = errors.New("message has been relayed by this bridge")
 )
 
+// bridgeRoute is a direction of the bridge from listener to publisher
+type bridgeRoute struct {
+	listener   mqtt.Subscriber
+	publisher  mqtt.Publisher
+	rules      []*rewriteRule
+	filters    filters
+	transforms pipeline
+}
+
+// initBridge loads bridge rules and connects reverse direction of bidirectional bridge
+func (c *client) initBridge(conf *config.Configuration) error {
+	reverse, err := c.loadBridge(conf)
+	if err != nil || reverse == nil {
+		return err
+	}
+	reverse.publisher, reverse.listener, err = mqtt.NewReverseClients(conf)
+	if err != nil {
+		return err
+	}
+	c.watchers = append(c.watchers, mqtt.WatchSecrets(conf, true, reverse.publisher, reverse.listener))
+	c.reverse = reverse
+	return nil
+}
+
+// loadBridge loads bridge rules and destinations, rules of the reverse direction are returned
+// for bidirectional bridge
+func (c *client) loadBridge(conf *config.Configuration) (*bridgeRoute, error) {
+	rules, err := loadRules(conf.BridgeRules, defaultRules(conf.NamespaceListener, conf.NamespacePublisher))
+	if err != nil {
+		return nil, err
+	}
+	c.rules = rules
+	if c.filters, err = loadFilters(conf.BridgeFilters); err != nil {
+		return nil, err
+	}
+	if c.transforms, err = loadTransforms(conf.BridgeTransforms, "bridge"); err != nil {
+		return nil, err
+	}
+	if conf.BridgeDestinations != "" {
+		if conf.BridgeReverse {
+			return nil, fmt.Errorf("BRIDGE_DESTINATIONS cannot be used with BRIDGE_BIDIRECTIONAL")
+		}
+		c.destinations, err = loadDestinations(conf.BridgeDestinations, conf)
+		return nil, err
+	}
+	if !conf.BridgeReverse {
+		return nil, nil
+	}
+	if conf.BridgeRaw {
+		return nil, fmt.Errorf("BRIDGE_BIDIRECTIONAL requires JSON envelopes: BRIDGE_RAW messages cannot be marked")
+	}
+	reverse := new(bridgeRoute)
+	reverse.rules, err = loadRules(conf.BridgeReverseRules, defaultRules(conf.NamespacePublisher, conf.NamespaceListener))
+	if err != nil {
+		return nil, err
+	}
+	if reverse.filters, err = loadFilters(conf.ReverseFilters); err != nil {
+		return nil, err
+	}
+	if reverse.transforms, err = loadTransforms(conf.ReverseTransforms, "reverse"); err != nil {
+		return nil, err
+	}
+	return reverse, nil
+}
+
 // runBridge starts program in Bridge mode
 func (c *client) runBridge() {
 	defer c.close()
@@ -24,16 +102,47 @@ func (c *client) runBridge() {
 	}
 
 	topic := fmt.Sprintf("%s/%s", os.Getenv("NAMESPACE_LISTENER"), c.topic)
+	routes := c.forwardRoutes()
+	for _, d := range c.destinations {
+		go d.run()
+	}
+	if config.Config.BridgeRaw {
+		received := make(chan mqtt.Received)
+		go c.listener.SubscribeFunc(topic, func(msg mqtt.Received) { received <- msg })
+		for msg := range received {
+			for _, route := range routes {
+				c.bridgeRaw(msg, route)
+			}
+		}
+		return
+	}
+	if c.reverse != nil {
+		reverseTopic := fmt.Sprintf("%s/%s", config.Config.NamespacePublisher, c.topic)
+		reverseChan := make(chan string)
+		go c.reverse.listener.SubscribeBridge(reverseTopic, reverseChan)
+		go c.relay(reverseChan, c.reverse)
+	}
 	msgChan := make(chan string)
 	go c.subscribeBridge(msgChan, topic)
+	c.relay(msgChan, routes...)
+}
 
-	for msg := range msgChan {
-		top, err := c.changeTopic(msg)
-		if err != nil {
-			continue
+// forwardRoutes returns routes of destinations or the route to publisher server if there are no destinations
+func (c *client) forwardRoutes() []*bridgeRoute {
+	if len(c.destinations) > 0 {
+		routes := make([]*bridgeRoute, len(c.destinations))
+		for i, d := range c.destinations {
+			routes[i] = d.route
 		}
-		c.publisher.Publish(top)
+		return routes
 	}
+	return []*bridgeRoute{{
+		listener:   c.listener,
+		publisher:  c.publisher,
+		rules:      c.bridgeRules(),
+		filters:    c.filters,
+		transforms: c.transforms,
+	}}
 }
 
 // subscribeBridge listen MQTT server
@@ -41,21 +150,157 @@ func (c *client) subscribeBridge(msgChan chan string, topic string) {
 	c.listener.SubscribeBridge(topic, msgChan)
 }
 
-// changeTopic changes topic of MQTT message
-func (c *client) changeTopic(msg string) (string, error) {
-	message := new(mqtt.Message)
-	err := json.Unmarshal([]byte(msg), message)
+// relay passes every message from msgChan to all routes
+func (c *client) relay(msgChan <-chan string, routes ...*bridgeRoute) {
+	for msg := range msgChan {
+		for _, route := range routes {
+			c.forward(msg, route)
+		}
+	}
+}
+
+// forward publishes message if it passes route filters,
+// topic is changed by route rules and message is reshaped by route transforms.
+// Transforms can't change loop markers set by bidirectional bridge
+func (c *client) forward(msg string, route *bridgeRoute) {
+	if !route.filters.match([]byte(msg)) {
+		logger.Log.Debugf("Message is filtered out by bridge: %q", msg)
+		return
+	}
+	top, err := c.changeTopic(msg, route.rules)
+	if err != nil {
+		return
+	}
+	out, err := route.transforms.apply([]byte(top))
+	if err == nil && config.Config.BridgeReverse && len(route.transforms) > 0 {
+		out, err = keepMarkers([]byte(top), out)
+	}
+	if err != nil {
+		logger.Log.Warnf("Cannot transform message %q: %v", top, err)
+		return
+	}
+	if err = route.publisher.Publish(string(out)); err != nil {
+		logger.Log.Warnf("Cannot publish bridged message: %v", err)
+	}
+}
+
+// changeTopic changes topic of MQTT message by the first matching rule.
+// Bidirectional bridge marks relayed messages and drops messages marked by itself
+func (c *client) changeTopic(msg string, rules []*rewriteRule) (string, error) {
+	env, err := parseEnvelope([]byte(msg))
 	if err != nil {
 		logger.Log.Warnf("Cannot unmarshal JSON message from Publisher: %q", msg)
 		return "", err
 	}
-	topic := strings.Replace(message.Topic, config.Config.NamespaceListener, config.Config.NamespacePublisher, 1)
-	msg = strings.Replace(msg, message.Topic, topic, 1)
-	return msg, nil
+	topic, ok := env.getString(topicField)
+	if !ok {
+		logger.Log.Warnf("Message from Publisher has no topic: %q", msg)
+		return "", errNoTopic
+	}
+	if config.Config.BridgeReverse {
+		if err = markRelayed(env, config.Config.BridgeOrigin); err != nil {
+			if err == errLoop {
+				logger.Log.Debugf("Message on topic %q has been relayed by this bridge, dropped", topic)
+			}
+			return "", err
+		}
+	}
+	newTopic, matched := rewriteTopic(rules, topic)
+	if !matched {
+		logger.Log.Debugf("No bridge rule matches topic %q, message dropped", topic)
+		return "", errNoRule
+	}
+	if err = env.set(topicField, newTopic); err != nil {
+		return "", err
+	}
+	data, err := env.bytes()
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// keepMarkers restores loop markers of relayed envelope in transformed one
+func keepMarkers(relayed, transformed []byte) ([]byte, error) {
+	src, err := parseEnvelope(relayed)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseEnvelope(transformed)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range []string{originField, viaField} {
+		if raw, ok := src.get(field); ok {
+			dst.setRaw(field, raw)
+		}
+	}
+	return dst.bytes()
+}
+
+// bridgeRaw publishes payload of MQTT message as is to the topic changed by the first matching route rule
+func (c *client) bridgeRaw(msg mqtt.Received, route *bridgeRoute) {
+	if !route.filters.match(msg.Payload) {
+		logger.Log.Debugf("Message on topic %q is filtered out by bridge", msg.Topic)
+		return
+	}
+	newTopic, ok := rewriteTopic(route.rules, msg.Topic)
+	if !ok {
+		logger.Log.Debugf("No bridge rule matches topic %q, message dropped", msg.Topic)
+		return
+	}
+	payload, err := route.transforms.apply(msg.Payload)
+	if err != nil {
+		logger.Log.Warnf("Cannot transform message on topic %q: %v", msg.Topic, err)
+		return
+	}
+	if err = route.publisher.PublishRaw(newTopic, payload, msg.Retained); err != nil {
+		logger.Log.Errorf("Cannot bridge message from %q to %q: %v", msg.Topic, newTopic, err)
+	}
+}
+
+// bridgeRules returns rules loaded on start, NAMESPACE rules are used if there are no loaded rules
+func (c *client) bridgeRules() []*rewriteRule {
+	if c.rules == nil {
+		return defaultRules(config.Config.NamespaceListener, config.Config.NamespacePublisher)
+	}
+	return c.rules
+}
+
+// markRelayed sets origin of the envelope, origin set by another bridge is kept and this bridge is added to via.
+// errLoop is returned if the envelope has already been relayed by this bridge
+func markRelayed(env *envelope, origin string) error {
+	first, found := env.getString(originField)
+	if !found {
+		return env.set(originField, origin)
+	}
+	if first == origin {
+		return errLoop
+	}
+	var via []string
+	if raw, ok := env.get(viaField); ok {
+		json.Unmarshal(raw, &via)
+	}
+	for _, bridge := range via {
+		if bridge == origin {
+			return errLoop
+		}
+	}
+	return env.set(viaField, append(via, origin))
 }
 
 // close disconnects from MQTT server
 func (c *client) close() {
+	for _, stop := range c.watchers {
+		stop()
+	}
 	c.listener.Disconnect()
 	c.publisher.Disconnect()
+	if c.reverse != nil {
+		c.reverse.listener.Disconnect()
+		c.reverse.publisher.Disconnect()
+	}
+	for _, d := range c.destinations {
+		d.Disconnect()
+	}
 }
@@ -1,8 +1,10 @@
 package adapter
 
 import (
+	"encoding/json"
 	"testing"
 	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/mqtt"
 	"strings"
 )
 
@@ -50,3 +52,146 @@ func TestWithSameNS(t *testing.T) {
 		t.Errorf("unexpected result, got: %s", wr.data)
 	}
 }
+
+func TestClient_changeTopic(t *testing.T) {
+	setLog(new(writer))
+	config.Config = &config.Configuration{NamespaceListener: "dev", NamespacePublisher: "prod"}
+	cl := client{}
+	testCases := []struct {
+		name     string
+		msg      string
+		expected string
+		fail     bool
+	}{
+		{"Test namespace prefix", `{"topic":"dev/a","payload":"dev/a"}`, `{"topic":"prod/a","payload":"dev/a"}`, false},
+		{"Test not matched topic", `{"topic":"test/dev/a"}`, "", true},
+		{"Test invalid JSON", `{"topic":`, "", true},
+		{"Test not string topic", `{"topic":123}`, "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := cl.changeTopic(tc.msg, cl.bridgeRules())
+			if got != tc.expected || (err != nil) != tc.fail {
+				t.Errorf("unexpected result: %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestClient_bridgeRaw(t *testing.T) {
+	wr := new(writer)
+	setLog(wr)
+	config.Config = &config.Configuration{NamespaceListener: "dev", NamespacePublisher: "prod"}
+	pub := new(recordPublisher)
+	cl := client{publisher: pub}
+	route := cl.forwardRoutes()[0]
+	cl.bridgeRaw(mqtt.Received{Topic: "dev/sensor/1", Payload: []byte("\x00not JSON")}, route)
+	cl.bridgeRaw(mqtt.Received{Topic: "third-party/sensor", Payload: []byte("{}")}, route)
+	if msgs := pub.messages(); len(msgs) != 1 || msgs[0] != "prod/sensor/1 \x00not JSON" {
+		t.Errorf("unexpected result: %q", msgs)
+	}
+
+	route.filters = filters{{Path: "level", Op: filterExists}}
+	cl.bridgeRaw(mqtt.Received{Topic: "dev/sensor/2", Payload: []byte("\x00not JSON")}, route)
+	cl.bridgeRaw(mqtt.Received{Topic: "dev/sensor/3", Payload: []byte(`{"level":1}`)}, route)
+	if msgs := pub.messages(); len(msgs) != 2 || msgs[1] != `prod/sensor/3 {"level":1}` {
+		t.Errorf("unexpected result: %q", msgs)
+	}
+}
+
+func TestClient_changeTopicBidirectional(t *testing.T) {
+	setLog(new(writer))
+	config.Config = &config.Configuration{
+		NamespaceListener:  "site-a",
+		NamespacePublisher: "site-b",
+		BridgeReverse:      true,
+		BridgeOrigin:       "bridge-1",
+	}
+	cl := client{}
+	forward, err := cl.changeTopic(`{"topic":"site-a/light"}`, cl.bridgeRules())
+	if err != nil || forward != `{"topic":"site-b/light","bridge_origin":"bridge-1"}` {
+		t.Fatalf("unexpected result: %q, %v", forward, err)
+	}
+	// the relayed message comes back through reverse direction
+	reverse := defaultRules("site-b", "site-a")
+	if _, err = cl.changeTopic(forward, reverse); err != errLoop {
+		t.Errorf("unexpected result: %v", err)
+	}
+	// messages relayed by another bridge are passed, their origin is kept
+	got, err := cl.changeTopic(`{"bridge_origin":"bridge-2","topic":"site-b/light"}`, reverse)
+	if err != nil || got != `{"bridge_origin":"bridge-2","topic":"site-a/light","bridge_via":["bridge-1"]}` {
+		t.Fatalf("unexpected result: %q, %v", got, err)
+	}
+	if _, err = cl.changeTopic(got, cl.bridgeRules()); err != errLoop {
+		t.Errorf("unexpected result: %v", err)
+	}
+}
+
+func TestClient_forwardKeepsMarkers(t *testing.T) {
+	setLog(new(writer))
+	config.Config = &config.Configuration{
+		NamespaceListener:  "site-a",
+		NamespacePublisher: "site-b",
+		BridgeReverse:      true,
+		BridgeOrigin:       "bridge-1",
+	}
+	pub := new(recordPublisher)
+	cl := client{publisher: pub}
+	route := cl.forwardRoutes()[0]
+	route.transforms = pipeline{
+		{Op: transformRemove, Path: originField},
+		{Op: transformSet, Path: viaField, Value: json.RawMessage(`[]`)},
+	}
+	if err := route.transforms.compile("bridge"); err != nil {
+		t.Fatal(err)
+	}
+	cl.forward(`{"topic":"site-a/light","bridge_origin":"bridge-2","bridge_via":["bridge-3"]}`, route)
+	msgs := pub.messages()
+	if len(msgs) != 1 {
+		t.Fatalf("unexpected result: %q", msgs)
+	}
+	env, err := parseEnvelope([]byte(msgs[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin, _ := env.getString(originField)
+	via, _ := env.get(viaField)
+	if origin != "bridge-2" || string(via) != `["bridge-3","bridge-1"]` {
+		t.Errorf("unexpected markers: %s", msgs[0])
+	}
+}
+
+func TestClient_runBridgeReverse(t *testing.T) {
+	setLog(new(writer))
+	loadConf()
+	config.Config.BridgeReverse = true
+	config.Config.BridgeOrigin = "bridge-1"
+	pub := new(recordPublisher)
+	cl := &client{
+		listener:  TestSubscriber{},
+		publisher: TestPublisher{},
+		topic:     "test_topic",
+		reverse: &bridgeRoute{
+			// the only reverse message is published last, so the reverse relay doesn't log after the test
+			listener:  TestSubscriber{bridged: []string{`{"topic":"test"}`}},
+			publisher: pub,
+			rules:     defaultRules("", "reverse/"),
+		},
+	}
+	cl.runBridge()
+	if msgs := waitMessages(pub, 1); len(msgs) != 1 || msgs[0] != `{"topic":"reverse/test","bridge_origin":"bridge-1"}` {
+		t.Errorf("unexpected result: %q", msgs)
+	}
+}
+
+func TestClient_initBridge(t *testing.T) {
+	cl := new(client)
+	conf := &config.Configuration{NamespaceListener: "a", NamespacePublisher: "b", BridgeReverse: true, BridgeRaw: true}
+	if err := cl.initBridge(conf); err == nil {
+		t.Error("Expected not <nil> error for raw bidirectional bridge")
+	}
+	conf.BridgeReverse = false
+	if err := cl.initBridge(conf); err != nil || len(cl.rules) != 1 || cl.reverse != nil {
+		t.Errorf("unexpected result: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package adapter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/metrics"
+)
+
+const (
+	// controlField is a name of envelope field with command of control envelope
+	controlField = "_control"
+	// okField is a name of confirmation field which tells if command is applied
+	okField = "ok"
+
+	controlSubscribe   = "subscribe"
+	controlUnsubscribe = "unsubscribe"
+)
+
+// control applies subscribe and unsubscribe commands of processor within ACL filters
+// and confirms them to processor
+type control struct {
+	acl       []string
+	subs      *subscriptions
+	processor io.Writer
+}
+
+// checkACL checks topic filters which processor may subscribe to
+func checkACL(acl []string) error {
+	for _, filter := range acl {
+		if err := checkFilter(filter); err != nil {
+			return fmt.Errorf("CONTROL_ACL: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkFilter checks that MQTT topic filter is not empty and its wildcards take whole levels, # is the last one
+func checkFilter(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("topic filter is empty")
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.ContainsAny(level, "+#") && len(level) > 1 {
+			return fmt.Errorf("%q has wildcard which is not a whole level", filter)
+		}
+		if level == "#" && i != len(levels)-1 {
+			return fmt.Errorf("%q has # which is not the last level", filter)
+		}
+	}
+	return nil
+}
+
+// allows checks if every topic matched by filter is matched by ACL filter
+func allows(acl, filter string) bool {
+	aclLevels := strings.Split(acl, "/")
+	levels := strings.Split(filter, "/")
+	for i, aclLevel := range aclLevels {
+		if aclLevel == "#" {
+			return true
+		}
+		if i == len(levels) {
+			return false
+		}
+		switch {
+		case levels[i] == "#":
+			return false
+		case aclLevel == "+", aclLevel == levels[i]:
+		default:
+			return false
+		}
+	}
+	return len(levels) == len(aclLevels)
+}
+
+// handle applies msg if it is a control envelope and writes confirmation to processor.
+// False is returned for other messages, error tells why the command is rejected
+func (ctl *control) handle(msg []byte) (bool, error) {
+	env, err := parseEnvelope(msg)
+	if err != nil {
+		return false, nil
+	}
+	command, ok := env.getString(controlField)
+	if !ok {
+		return false, nil
+	}
+	filter, _ := env.getString(topicField)
+	err = ctl.apply(command, filter)
+	if err != nil {
+		logger.Log.Warnf("Control envelope is rejected: %v", err)
+		metrics.Stats.Add("control_rejected", 1)
+	} else {
+		logger.Log.Infof("Processor control: %s %q", command, filter)
+	}
+	ctl.confirm(env, command, filter, err)
+	return true, err
+}
+
+// apply runs command on subscriptions
+func (ctl *control) apply(command, filter string) error {
+	switch command {
+	case controlSubscribe, controlUnsubscribe:
+	default:
+		return fmt.Errorf("unknown command %q, expected %s or %s", command, controlSubscribe, controlUnsubscribe)
+	}
+	if err := checkFilter(filter); err != nil {
+		return err
+	}
+	if command == controlUnsubscribe {
+		return ctl.subs.remove(filter)
+	}
+	for _, acl := range ctl.acl {
+		if allows(acl, filter) {
+			ctl.subs.add(filter)
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not allowed by CONTROL_ACL", filter)
+}
+
+// confirm writes result of the command to processor, correlation_id of the command is kept
+func (ctl *control) confirm(env *envelope, command, filter string, err error) {
+	reply := envelope{}
+	reply.set(controlField, command)
+	reply.set(topicField, filter)
+	reply.set(okField, err == nil)
+	if id, ok := env.get(correlationField); ok {
+		reply.setRaw(correlationField, id)
+	}
+	if err != nil {
+		reply.set(errorField, err.Error())
+	}
+	data, _ := reply.bytes()
+	if _, err = ctl.processor.Write(data); err != nil {
+		logger.Log.Errorf("Cannot confirm control envelope to processor: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package adapter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestCheckACL(t *testing.T) {
+	if err := checkACL([]string{"devices/+/#", "alerts"}); err != nil {
+		t.Error(err)
+	}
+	for _, value := range []string{"devices/#/status", "devices/4+"} {
+		if err := checkACL([]string{"alerts", value}); err == nil {
+			t.Errorf("Expected not <nil> error for %q", value)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	testCases := []struct {
+		acl      string
+		filter   string
+		expected bool
+	}{
+		{"devices/#", "devices/42/#", true},
+		{"devices/#", "devices", true},
+		{"devices/+/status", "devices/42/status", true},
+		{"devices/+/status", "devices/+/status", true},
+		{"devices/+/status", "devices/#", false},
+		{"devices/+/status", "devices/42", false},
+		{"devices/+/status", "devices/42/status/x", false},
+		{"devices/42", "devices/43", false},
+		{"#", "any/topic/#", true},
+	}
+	for _, tc := range testCases {
+		if got := allows(tc.acl, tc.filter); got != tc.expected {
+			t.Errorf("allows(%q, %q) = %v", tc.acl, tc.filter, got)
+		}
+	}
+}
+
+func TestControl_handle(t *testing.T) {
+	setLog(ioutil.Discard)
+	sub := new(recordSubscriber)
+	subs := &subscriptions{
+		namespace: "prod",
+		subscribe: func(topic string) { sub.Subscribe(topic, nil) },
+		listener:  sub,
+		filters:   map[string]bool{"dev/#": true},
+		dynamic:   map[string]bool{},
+	}
+	processor := new(writer)
+	ctl := &control{acl: []string{"devices/+/#", "dev/#"}, subs: subs, processor: processor}
+
+	testCases := []struct {
+		name    string
+		msg     string
+		handled bool
+		ok      bool
+	}{
+		{"Test not control envelope", `{"topic":"prod/out"}`, false, false},
+		{"Test not JSON", `devices`, false, false},
+		{"Test subscribe", `{"_control":"subscribe","topic":"devices/42/#","correlation_id":"1"}`, true, true},
+		{"Test subscribe again", `{"_control":"subscribe","topic":"devices/42/#"}`, true, true},
+		{"Test subscribe out of ACL", `{"_control":"subscribe","topic":"devices/#"}`, true, false},
+		{"Test not correct filter", `{"_control":"subscribe","topic":"devices/4#"}`, true, false},
+		{"Test unknown command", `{"_control":"pause","topic":"devices/42/#"}`, true, false},
+		{"Test unsubscribe file filter", `{"_control":"unsubscribe","topic":"dev/#"}`, true, false},
+		{"Test unsubscribe", `{"_control":"unsubscribe","topic":"devices/42/#"}`, true, true},
+		{"Test unsubscribe not subscribed", `{"_control":"unsubscribe","topic":"devices/42/#"}`, true, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			processor.data = ""
+			handled, err := ctl.handle([]byte(tc.msg))
+			if handled != tc.handled || (handled && (err == nil) != tc.ok) {
+				t.Fatalf("unexpected result: %v, %v", handled, err)
+			}
+			if !handled {
+				return
+			}
+			var reply map[string]interface{}
+			if err = json.Unmarshal([]byte(processor.data), &reply); err != nil {
+				t.Fatal(err)
+			}
+			if reply[okField] != tc.ok || reply[controlField] == nil || reply[topicField] == nil {
+				t.Errorf("unexpected confirmation: %s", processor.data)
+			}
+		})
+	}
+	subscribed, unsubscribed := sub.topics()
+	if !reflect.DeepEqual(subscribed, []string{"prod/devices/42/#"}) || !reflect.DeepEqual(unsubscribed, []string{"prod/devices/42/#"}) {
+		t.Errorf("unexpected topics: %v, %v", subscribed, unsubscribed)
+	}
+}
@@ -0,0 +1,262 @@
+package adapter
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/metrics"
+	"mqtt-adapter/src/mqtt"
+)
+
+const (
+	// rawMarker starts queued raw messages, JSON envelopes can't start with it
+	rawMarker = 0
+	// defaultMaxAttempts is the number of attempts to publish a message before it is dropped
+	defaultMaxAttempts = 10
+)
+
+// destination is a broker the bridge forwards messages to as it is set in destinations file.
+// It implements mqtt.Publisher: messages are queued and published by run
+type destination struct {
+	Name          string           `json:"name"`
+	URL           string           `json:"url"`
+	Username      string           `json:"username"`
+	Password      string           `json:"password"`
+	PasswordFile  string           `json:"password_file"`
+	TLS           *mqtt.TLSOptions `json:"tls"`
+	Rules         []*rewriteRule   `json:"rules"`
+	Filters       filters          `json:"filters"`
+	Transforms    pipeline         `json:"transforms"`
+	QueueSize     int              `json:"queue_size"`
+	QueueOverflow string           `json:"queue_overflow"`
+	MaxAttempts   int              `json:"max_attempts"`
+
+	queue   *queue
+	tlsConf *tls.Config
+	connect func() (mqtt.Publisher, error)
+	route   *bridgeRoute
+
+	mu        sync.Mutex
+	publisher mqtt.Publisher
+	done      chan struct{}
+}
+
+// writerFunc is an io.Writer calling the function
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// loadDestinations reads destinations from JSON file
+func loadDestinations(path string, conf *config.Configuration) ([]*destination, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read bridge destinations: %v", err)
+	}
+	var dests []*destination
+	if err = json.Unmarshal(data, &dests); err != nil {
+		return nil, fmt.Errorf("cannot parse bridge destinations %s: %v", path, err)
+	}
+	names := map[string]bool{}
+	for i, d := range dests {
+		if d.Name == "" {
+			d.Name = fmt.Sprintf("destination%d", i)
+		}
+		if names[d.Name] {
+			return nil, fmt.Errorf("bridge destinations %s: duplicate name %q", path, d.Name)
+		}
+		names[d.Name] = true
+		if err = d.init(conf); err != nil {
+			return nil, fmt.Errorf("bridge destinations %s: %s: %v", path, d.Name, err)
+		}
+	}
+	return dests, nil
+}
+
+// init checks destination settings and creates its queue and route
+func (d *destination) init(conf *config.Configuration) error {
+	if d.URL == "" {
+		return fmt.Errorf("url is not set")
+	}
+	if d.Rules == nil {
+		d.Rules = defaultRules(conf.NamespaceListener, conf.NamespacePublisher)
+	}
+	if err := compileRules(d.Rules); err != nil {
+		return err
+	}
+	if err := d.Filters.compile(); err != nil {
+		return err
+	}
+	if err := d.Transforms.compile(d.Name); err != nil {
+		return err
+	}
+	if d.QueueOverflow == "" {
+		d.QueueOverflow = overflowDropOldest
+	}
+	if d.MaxAttempts == 0 {
+		d.MaxAttempts = defaultMaxAttempts
+	}
+	if d.QueueOverflow == overflowDisconnect {
+		return fmt.Errorf("queue_overflow %q is not supported by destinations", overflowDisconnect)
+	}
+	var err error
+	if d.queue, err = newQueue(d.Name, d.QueueSize, d.QueueOverflow, nil); err != nil {
+		return err
+	}
+	if d.TLS != nil {
+		if d.tlsConf, err = d.TLS.Config(); err != nil {
+			return err
+		}
+	}
+	credo, err := config.ResolveCredentials(d.URL, d.Username, d.Password, d.PasswordFile)
+	if err != nil {
+		return err
+	}
+	clientID := fmt.Sprintf("%s_%s_%s_%s", conf.Name, conf.Host, conf.UUID, d.Name)
+	d.connect = func() (mqtt.Publisher, error) {
+		return mqtt.NewPublisher(d.URL, clientID, credo, d.tlsConf)
+	}
+	d.route = &bridgeRoute{publisher: d, rules: d.Rules, filters: d.Filters, transforms: d.Transforms}
+	d.done = make(chan struct{})
+	return nil
+}
+
+// run publishes queued messages until the destination is disconnected
+func (d *destination) run() {
+	d.queue.expose()
+	d.queue.drain(writerFunc(d.send))
+}
+
+// Publish queues envelope
+func (d *destination) Publish(msg string) error {
+	_, err := d.queue.Write([]byte(msg))
+	return err
+}
+
+// PublishRaw queues payload with its topic
+func (d *destination) PublishRaw(topic string, payload []byte, retained bool) error {
+	item := []byte{rawMarker, 0}
+	if retained {
+		item[1] = 1
+	}
+	item = append(item, topic...)
+	item = append(item, 0)
+	_, err := d.queue.Write(append(item, payload...))
+	return err
+}
+
+// Disconnect stops publishing and disconnects from the broker
+func (d *destination) Disconnect() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	select {
+	case <-d.done:
+		return
+	default:
+		close(d.done)
+	}
+	d.queue.close()
+	if d.publisher != nil {
+		d.publisher.Disconnect()
+	}
+}
+
+// send publishes queued message, it connects to the broker if it is not connected. A failed connection
+// or publish is retried with backoff over a new connection, the message is dropped after max_attempts
+// (negative value retries until the destination is disconnected)
+func (d *destination) send(item []byte) (int, error) {
+	backoff := reconnectMinBackoff
+	for attempt := 1; ; attempt++ {
+		pub, err := d.connected()
+		if err == errQueueClosed {
+			return 0, err
+		}
+		if err == nil {
+			if err = publishItem(pub, item); err == nil {
+				return len(item), nil
+			}
+			metrics.Stats.Add(d.Name+"_publish_errors", 1)
+			d.reset(pub)
+		}
+		if d.MaxAttempts > 0 && attempt >= d.MaxAttempts {
+			metrics.Stats.Add(d.Name+"_publish_dropped", 1)
+			logger.Log.Errorf("Message of %d bytes to bridge destination %s dropped after %d attempts: %v",
+				len(item), d.Name, attempt, err)
+			return len(item), nil
+		}
+		logger.Log.Warnf("Cannot publish to bridge destination %s: %v. Retry in %s", d.Name, err, backoff)
+		select {
+		case <-d.done:
+			return 0, errQueueClosed
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
+
+// publishItem publishes queued envelope or raw message
+func publishItem(pub mqtt.Publisher, item []byte) error {
+	if len(item) > 0 && item[0] == rawMarker {
+		i := bytes.IndexByte(item[2:], 0)
+		return pub.PublishRaw(string(item[2:2+i]), item[3+i:], item[1] == 1)
+	}
+	return pub.Publish(string(item))
+}
+
+// attach sets connected publisher, it is disconnected and false is returned if the destination has been stopped
+func (d *destination) attach(pub mqtt.Publisher) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	select {
+	case <-d.done:
+		pub.Disconnect()
+		return false
+	default:
+		d.publisher = pub
+		logger.Log.Infof("Bridge destination %s is connected", d.Name)
+		return true
+	}
+}
+
+// reset drops failed publisher, so the next message is sent over a new connection
+func (d *destination) reset(pub mqtt.Publisher) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.publisher == pub {
+		d.publisher = nil
+		pub.Disconnect()
+	}
+}
+
+// connected returns publisher connected to the destination broker, it connects if there is no connection
+func (d *destination) connected() (mqtt.Publisher, error) {
+	d.mu.Lock()
+	pub := d.publisher
+	d.mu.Unlock()
+	if pub != nil {
+		return pub, nil
+	}
+	select {
+	case <-d.done:
+		return nil, errQueueClosed
+	default:
+	}
+	pub, err := d.connect()
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect: %v", err)
+	}
+	if d.attach(pub) {
+		return pub, nil
+	}
+	return nil, errQueueClosed
+}
@@ -0,0 +1,185 @@
+package adapter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/mqtt"
+)
+
+func testDestination(t *testing.T, name string, pub mqtt.Publisher) *destination {
+	d := &destination{Name: name, URL: "tcp://test:1883"}
+	if err := d.init(&config.Configuration{NamespacePublisher: name + "/"}); err != nil {
+		t.Fatal(err)
+	}
+	d.connect = func() (mqtt.Publisher, error) { return pub, nil }
+	return d
+}
+
+func TestLoadDestinations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "destinations.json")
+	conf := &config.Configuration{NamespaceListener: "plant", NamespacePublisher: "cloud"}
+
+	ioutil.WriteFile(path, []byte(`[
+		{"name":"analytics","url":"ssl://analytics:8883","tls":{"insecure_skip_verify":true},
+		 "filters":[{"path":"payload.severity","op":"eq","value":"error"}],
+		 "rules":[{"type":"prefix","match":"plant/","replace":"analytics/"}],
+		 "queue_size":10},
+		{"url":"tcp://backup:1883","transforms":[{"op":"set","path":"backup","value":true}]}
+	]`), 0600)
+	dests, err := loadDestinations(path, conf)
+	if err != nil || len(dests) != 2 {
+		t.Fatalf("unexpected result: %v, %v", dests, err)
+	}
+	if dests[0].tlsConf == nil || dests[0].queue.size != 10 || len(dests[0].route.filters) != 1 {
+		t.Errorf("unexpected destination: %+v", dests[0])
+	}
+	if dests[1].Name != "destination1" || dests[1].Rules[0].Replace != "cloud" || dests[1].QueueOverflow != overflowDropOldest {
+		t.Errorf("unexpected destination: %+v", dests[1])
+	}
+
+	testCases := []struct {
+		name string
+		data string
+	}{
+		{"Test without url", `[{"name":"a"}]`},
+		{"Test duplicate names", `[{"name":"a","url":"tcp://a"},{"name":"a","url":"tcp://b"}]`},
+		{"Test disconnect overflow", `[{"url":"tcp://a","queue_overflow":"disconnect"}]`},
+		{"Test bad rule", `[{"url":"tcp://a","rules":[{"type":"glob"}]}]`},
+		{"Test bad TLS", `[{"url":"tcp://a","tls":{"ca":"missing.pem"}}]`},
+		{"Test missing password file", `[{"url":"tcp://a","username":"a","password_file":"missing"}]`},
+		{"Test not JSON", `{`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ioutil.WriteFile(path, []byte(tc.data), 0600)
+			if _, err := loadDestinations(path, conf); err == nil {
+				t.Error("Expected not <nil> error")
+			}
+		})
+	}
+}
+
+// failPublisher fails every publish
+type failPublisher struct{ recordPublisher }
+
+func (p *failPublisher) Publish(msg string) error { return errors.New("connection lost") }
+
+func TestDestination_run(t *testing.T) {
+	setLog(new(writer))
+	pub := new(recordPublisher)
+	d := testDestination(t, "cloud", pub)
+	done := make(chan struct{})
+	go func() {
+		d.run()
+		close(done)
+	}()
+
+	d.Publish(`{"topic":"cloud/a"}`)
+	d.PublishRaw("cloud/raw", []byte("\x00raw"), true)
+	msgs := waitMessages(pub, 2)
+	if len(msgs) != 2 || msgs[0] != `{"topic":"cloud/a"}` || msgs[1] != "cloud/raw \x00raw" {
+		t.Errorf("unexpected result: %q", msgs)
+	}
+	d.Disconnect()
+	d.Disconnect()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("destination was not stopped")
+	}
+	if err := d.Publish(`{}`); err != errQueueClosed {
+		t.Errorf("unexpected result: %v", err)
+	}
+
+	// failed publisher is dropped and the message is published over a new connection
+	pub = new(recordPublisher)
+	d = testDestination(t, "backup", pub)
+	d.attach(new(failPublisher))
+	if _, err := d.send([]byte(`{"topic":"backup/a"}`)); err != nil || d.publisher != pub {
+		t.Errorf("unexpected result: %v, %v", err, d.publisher)
+	}
+	if msgs := pub.messages(); len(msgs) != 1 || msgs[0] != `{"topic":"backup/a"}` {
+		t.Errorf("message is not published again: %q", msgs)
+	}
+
+	// retries end when the destination is disconnected
+	d = testDestination(t, "backup", new(failPublisher))
+	sent := make(chan error)
+	go func() {
+		_, err := d.send([]byte(`{}`))
+		sent <- err
+	}()
+	time.Sleep(time.Millisecond * 100)
+	d.Disconnect()
+	select {
+	case err := <-sent:
+		if err != errQueueClosed {
+			t.Errorf("unexpected result: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("send doesn't stop retrying")
+	}
+
+	// message is dropped after max_attempts failed publishes or connections
+	d = testDestination(t, "backup", new(failPublisher))
+	if d.MaxAttempts != defaultMaxAttempts {
+		t.Errorf("unexpected max_attempts: %d", d.MaxAttempts)
+	}
+	d.MaxAttempts = 1
+	if n, err := d.send([]byte(`{}`)); err != nil || n != 2 {
+		t.Errorf("unexpected result: %d, %v", n, err)
+	}
+	d.connect = func() (mqtt.Publisher, error) { return nil, errors.New("not authorized") }
+	if n, err := d.send([]byte(`{}`)); err != nil || n != 2 {
+		t.Errorf("unexpected result: %d, %v", n, err)
+	}
+}
+
+func TestClient_relayDestinations(t *testing.T) {
+	setLog(new(writer))
+	loadConf()
+	cloud, backup := new(recordPublisher), new(recordPublisher)
+	slow := testDestination(t, "slow", new(recordPublisher))
+	slow.connect = func() (mqtt.Publisher, error) { return nil, errors.New("unavailable") }
+	cl := &client{
+		listener:     TestSubscriber{},
+		publisher:    TestPublisher{},
+		destinations: []*destination{testDestination(t, "cloud", cloud), slow, testDestination(t, "backup", backup)},
+	}
+	// destinations are stopped and waited for, so they don't log after the test
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cl.close()
+	for _, d := range cl.destinations {
+		wg.Add(1)
+		go func(d *destination) {
+			defer wg.Done()
+			d.run()
+		}(d)
+	}
+	msgChan := make(chan string, 2)
+	msgChan <- `{"topic":"a"}`
+	msgChan <- `{"topic":"b"}`
+	close(msgChan)
+	cl.relay(msgChan, cl.forwardRoutes()...)
+
+	// unavailable destination doesn't stall the others
+	for name, pub := range map[string]*recordPublisher{"cloud": cloud, "backup": backup} {
+		msgs := waitMessages(pub, 2)
+		if len(msgs) != 2 || msgs[0] != `{"topic":"`+name+`/a"}` {
+			t.Errorf("unexpected result: %q", msgs)
+		}
+	}
+}
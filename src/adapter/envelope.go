@@ -0,0 +1,131 @@
+package adapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// topicField is a name of envelope field with MQTT topic
+const topicField = "topic"
+
+// envelope is a JSON object exchanged with processor, values of unknown fields are kept as is
+// and fields are encoded in the order they were read or set
+type envelope struct {
+	fields map[string]json.RawMessage
+	keys   []string
+}
+
+// parseEnvelope decodes JSON object
+func parseEnvelope(msg []byte) (*envelope, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("envelope is not a JSON object")
+	}
+	// the message is a valid object, fields are read one by one to keep their order
+	decoder := json.NewDecoder(bytes.NewReader(msg))
+	decoder.Token()
+	env := &envelope{}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		var raw json.RawMessage
+		if err = decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		env.setRaw(key.(string), raw)
+	}
+	return env, nil
+}
+
+// get returns raw value of the field, false is returned if the field is absent
+func (e *envelope) get(field string) (json.RawMessage, bool) {
+	raw, ok := e.fields[field]
+	return raw, ok
+}
+
+// getString returns string value of the field, false is returned if the field is absent or is not a string
+func (e *envelope) getString(field string) (string, bool) {
+	raw, ok := e.fields[field]
+	if !ok {
+		return "", false
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// set replaces value of the field
+func (e *envelope) set(field string, value interface{}) error {
+	raw, err := marshal(value)
+	if err != nil {
+		return err
+	}
+	e.setRaw(field, raw)
+	return nil
+}
+
+// setRaw replaces value of the field with JSON value, new fields are added to the end
+func (e *envelope) setRaw(field string, raw json.RawMessage) {
+	if e.fields == nil {
+		e.fields = map[string]json.RawMessage{}
+	}
+	if _, ok := e.fields[field]; !ok {
+		e.keys = append(e.keys, field)
+	}
+	e.fields[field] = raw
+}
+
+// remove removes the field
+func (e *envelope) remove(field string) {
+	if _, ok := e.fields[field]; !ok {
+		return
+	}
+	delete(e.fields, field)
+	for i, key := range e.keys {
+		if key == field {
+			e.keys = append(e.keys[:i], e.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// bytes encodes envelope to compact JSON, HTML characters are not escaped
+func (e *envelope) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range e.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		if err = json.Compact(&buf, e.fields[field]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshal encodes value to JSON without escaping HTML characters
+func marshal(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,28 @@
+package adapter
+
+import "testing"
+
+func TestEnvelope(t *testing.T) {
+	env, err := parseEnvelope([]byte(`{"topic":"a/b","payload":{"b": 1, "a": [2]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic, ok := env.getString(topicField); !ok || topic != "a/b" {
+		t.Errorf("unexpected topic: %q", topic)
+	}
+	if _, ok := env.getString("payload"); ok {
+		t.Error("payload is not a string")
+	}
+	env.set(topicField, "c/d")
+	env.set("note", "<a> & <b>")
+	data, err := env.bytes()
+	if err != nil || string(data) != `{"topic":"c/d","payload":{"b":1,"a":[2]},"note":"<a> & <b>"}` {
+		t.Errorf("unexpected result: %s, %v", data, err)
+	}
+
+	for _, msg := range []string{`[1]`, `null`, `{`} {
+		if _, err = parseEnvelope([]byte(msg)); err == nil {
+			t.Errorf("Expected not <nil> error for %s", msg)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"mqtt-adapter/src/mqtt"
+)
+
+const (
+	filterEq     = "eq"
+	filterNe     = "ne"
+	filterGt     = "gt"
+	filterGte    = "gte"
+	filterLt     = "lt"
+	filterLte    = "lte"
+	filterIn     = "in"
+	filterRegex  = "regex"
+	filterExists = "exists"
+	// filterSample passes random share of messages set by value from 0 to 1
+	filterSample = "sample"
+)
+
+// messageFilter is a condition on a field of JSON message as it is set in filters file.
+// Order lists string values from the lowest to the highest, so gt, gte, lt and lte compare them by position
+type messageFilter struct {
+	Path  string          `json:"path"`
+	Op    string          `json:"op"`
+	Value json.RawMessage `json:"value"`
+	Order []string        `json:"order"`
+
+	value interface{}
+	limit float64
+	re    *regexp.Regexp
+}
+
+// filters passes a message if all of them match it
+type filters []*messageFilter
+
+// match checks if the message passes all filters
+func (fs filters) match(msg []byte) bool {
+	for _, f := range fs {
+		if !f.match(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// compile checks the filter and decodes its value
+func (f *messageFilter) compile() error {
+	if f.Op != filterSample && f.Path == "" {
+		return fmt.Errorf("path of %q filter is not set", f.Op)
+	}
+	if f.Op != filterExists {
+		if err := json.Unmarshal(f.Value, &f.value); err != nil {
+			return fmt.Errorf("invalid value of %q filter: %v", f.Op, err)
+		}
+	}
+	switch f.Op {
+	case filterEq, filterNe, filterExists:
+	case filterGt, filterGte, filterLt, filterLte:
+		limit, ok := f.rank(f.value)
+		if !ok && f.Order != nil {
+			return fmt.Errorf("value of %q filter must be one of order %q", f.Op, f.Order)
+		}
+		if !ok {
+			return fmt.Errorf("value of %q filter must be a number or a string with order", f.Op)
+		}
+		f.limit = limit
+	case filterIn:
+		if _, ok := f.value.([]interface{}); !ok {
+			return fmt.Errorf("value of %q filter must be an array", f.Op)
+		}
+	case filterRegex:
+		expr, ok := f.value.(string)
+		if !ok {
+			return fmt.Errorf("value of %q filter must be a string", f.Op)
+		}
+		var err error
+		if f.re, err = regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid regex filter %q: %v", expr, err)
+		}
+	case filterSample:
+		if ratio, ok := f.value.(float64); !ok || ratio < 0 || ratio > 1 {
+			return fmt.Errorf("value of %q filter must be a number from 0 to 1", f.Op)
+		}
+	default:
+		return fmt.Errorf("unknown filter %q", f.Op)
+	}
+	return nil
+}
+
+// match checks if the message passes the filter
+func (f *messageFilter) match(msg []byte) bool {
+	if f.Op == filterSample {
+		return rand.Float64() < f.value.(float64)
+	}
+	raw, found := mqtt.LookupKey(msg, strings.TrimPrefix(f.Path, "$."))
+	if f.Op == filterExists {
+		return found
+	}
+	if !found {
+		return false
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return false
+	}
+	switch f.Op {
+	case filterEq:
+		return reflect.DeepEqual(value, f.value)
+	case filterNe:
+		return !reflect.DeepEqual(value, f.value)
+	case filterIn:
+		for _, item := range f.value.([]interface{}) {
+			if reflect.DeepEqual(value, item) {
+				return true
+			}
+		}
+		return false
+	case filterRegex:
+		s, ok := value.(string)
+		return ok && f.re.MatchString(s)
+	}
+	number, ok := f.rank(value)
+	if !ok {
+		return false
+	}
+	limit := f.limit
+	switch f.Op {
+	case filterGt:
+		return number > limit
+	case filterGte:
+		return number >= limit
+	case filterLt:
+		return number < limit
+	default:
+		return number <= limit
+	}
+}
+
+// rank returns number to compare the value by, it is a position in order for strings and the number itself otherwise
+func (f *messageFilter) rank(value interface{}) (float64, bool) {
+	if f.Order == nil {
+		number, ok := value.(float64)
+		return number, ok
+	}
+	s, ok := value.(string)
+	if !ok {
+		return 0, false
+	}
+	for i, item := range f.Order {
+		if item == s {
+			return float64(i), true
+		}
+	}
+	return 0, false
+}
+
+// loadFilters reads message filters from JSON file, nil is returned if path is empty
+func loadFilters(path string) (filters, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read bridge filters: %v", err)
+	}
+	var fs filters
+	if err = json.Unmarshal(data, &fs); err != nil {
+		return nil, fmt.Errorf("cannot parse bridge filters %s: %v", path, err)
+	}
+	if err = fs.compile(); err != nil {
+		return nil, fmt.Errorf("bridge filters %s: %v", path, err)
+	}
+	return fs, nil
+}
+
+// compile compiles all filters
+func (fs filters) compile() error {
+	for _, f := range fs {
+		if err := f.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package adapter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMessageFilter_match(t *testing.T) {
+	msg := []byte(`{"topic":"plant/line1","payload":{"severity":"warning","level":7,"tags":["a"]}}`)
+	testCases := []struct {
+		name     string
+		filter   string
+		expected bool
+	}{
+		{"Test eq", `{"path":"payload.severity","op":"eq","value":"warning"}`, true},
+		{"Test eq with other value", `{"path":"payload.severity","op":"eq","value":"info"}`, false},
+		{"Test eq with array", `{"path":"payload.tags","op":"eq","value":["a"]}`, true},
+		{"Test ne", `{"path":"payload.severity","op":"ne","value":"info"}`, true},
+		{"Test ne missing field", `{"path":"payload.missing","op":"ne","value":"info"}`, false},
+		{"Test in", `{"path":"payload.severity","op":"in","value":["warning","error"]}`, true},
+		{"Test not in", `{"path":"payload.severity","op":"in","value":["error"]}`, false},
+		{"Test regex", `{"path":"topic","op":"regex","value":"^plant/line\\d$"}`, true},
+		{"Test regex on number", `{"path":"payload.level","op":"regex","value":"7"}`, false},
+		{"Test gte", `{"path":"payload.level","op":"gte","value":7}`, true},
+		{"Test gt", `{"path":"payload.level","op":"gt","value":7}`, false},
+		{"Test lt", `{"path":"payload.level","op":"lt","value":10}`, true},
+		{"Test lte on string", `{"path":"payload.severity","op":"lte","value":10}`, false},
+		{"Test gte with order", `{"path":"payload.severity","op":"gte","value":"warning","order":["info","warning","error"]}`, true},
+		{"Test gt with order", `{"path":"payload.severity","op":"gt","value":"warning","order":["info","warning","error"]}`, false},
+		{"Test lt with order and unknown value", `{"path":"payload.level","op":"lt","value":"error","order":["info","warning","error"]}`, false},
+		{"Test JSONPath prefix", `{"path":"$.payload.level","op":"eq","value":7}`, true},
+		{"Test exists", `{"path":"payload.tags","op":"exists"}`, true},
+		{"Test not exists", `{"path":"payload.tags.a","op":"exists"}`, false},
+		{"Test sample all", `{"op":"sample","value":1}`, true},
+		{"Test sample none", `{"op":"sample","value":0}`, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := new(messageFilter)
+			if err := json.Unmarshal([]byte(tc.filter), f); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.compile(); err != nil {
+				t.Fatal(err)
+			}
+			if got := f.match(msg); got != tc.expected {
+				t.Errorf("unexpected result: %v", got)
+			}
+		})
+	}
+	if (filters{}).match([]byte("not JSON")) != true {
+		t.Error("empty filters must pass any message")
+	}
+}
+
+func TestMessageFilter_compile(t *testing.T) {
+	testCases := []struct {
+		name   string
+		filter messageFilter
+	}{
+		{"Test without path", messageFilter{Op: filterEq, Value: json.RawMessage(`1`)}},
+		{"Test unknown op", messageFilter{Path: "a", Op: "like", Value: json.RawMessage(`1`)}},
+		{"Test gt with string", messageFilter{Path: "a", Op: filterGt, Value: json.RawMessage(`"1"`)}},
+		{"Test gt with string not in order", messageFilter{Path: "a", Op: filterGt, Value: json.RawMessage(`"fatal"`), Order: []string{"info", "error"}}},
+		{"Test gt with number and order", messageFilter{Path: "a", Op: filterGt, Value: json.RawMessage(`1`), Order: []string{"info", "error"}}},
+		{"Test in with number", messageFilter{Path: "a", Op: filterIn, Value: json.RawMessage(`1`)}},
+		{"Test bad regex", messageFilter{Path: "a", Op: filterRegex, Value: json.RawMessage(`"("`)}},
+		{"Test sample above 1", messageFilter{Op: filterSample, Value: json.RawMessage(`2`)}},
+		{"Test without value", messageFilter{Path: "a", Op: filterEq}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.filter.compile(); err == nil {
+				t.Error("Expected not <nil> error")
+			}
+		})
+	}
+}
+
+func TestLoadFilters(t *testing.T) {
+	if fs, err := loadFilters(""); fs != nil || err != nil {
+		t.Errorf("unexpected result: %v, %v", fs, err)
+	}
+	dir, err := ioutil.TempDir("", "adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "filters.json")
+	ioutil.WriteFile(path, []byte(`[{"path":"payload.severity","op":"in","value":["warning","error"]}]`), 0600)
+	fs, err := loadFilters(path)
+	if err != nil || len(fs) != 1 {
+		t.Fatalf("unexpected result: %v, %v", fs, err)
+	}
+	if !fs.match([]byte(`{"payload":{"severity":"error"}}`)) || fs.match([]byte(`{"payload":{"severity":"info"}}`)) {
+		t.Error("unexpected filtering")
+	}
+	ioutil.WriteFile(path, []byte(`[{"op":"sample"}]`), 0600)
+	if _, err = loadFilters(path); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+}
@@ -0,0 +1,232 @@
+package adapter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+
+	"mqtt-adapter/src/logger"
+)
+
+const (
+	framingNDJSON         = "ndjson"
+	framingLengthPrefixed = "length-prefixed"
+	framingNetstring      = "netstring"
+
+	// defaultMaxMessageSize is used when MAX_MESSAGE_SIZE is not set
+	defaultMaxMessageSize = 16 * 1024 * 1024
+	// lengthPrefixSize is a size of big-endian length header in length-prefixed framing
+	lengthPrefixSize = 4
+	// netstringHeaderSize is a maximum size of "<len>:" header in netstring framing
+	netstringHeaderSize = 11
+)
+
+// framing describes how messages are delimited on processor stdin and stdout
+type framing struct {
+	encode   func(msg []byte) []byte
+	split    func(maxSize int) bufio.SplitFunc
+	overhead int
+}
+
+var framings = map[string]framing{
+	framingNDJSON:         {encode: encodeNDJSON, split: splitNDJSON, overhead: 2},
+	framingLengthPrefixed: {encode: encodeLengthPrefixed, split: splitLengthPrefixed, overhead: lengthPrefixSize},
+	framingNetstring:      {encode: encodeNetstring, split: splitNetstring, overhead: netstringHeaderSize + 1},
+}
+
+// getFraming returns framing by its name, empty name means ndjson
+func getFraming(name string) (framing, error) {
+	if name == "" {
+		name = framingNDJSON
+	}
+	f, ok := framings[name]
+	if !ok {
+		return framing{}, fmt.Errorf("unknown framing %q", name)
+	}
+	return f, nil
+}
+
+// frameWriter writes every message passed to Write as a single frame
+type frameWriter struct {
+	w      io.Writer
+	encode func(msg []byte) []byte
+}
+
+// newFrameWriter wraps processor stdin with specified framing
+func newFrameWriter(w io.Writer, name string) (io.Writer, error) {
+	f, err := getFraming(name)
+	if err != nil {
+		return nil, err
+	}
+	return &frameWriter{w: w, encode: f.encode}, nil
+}
+
+// Write writes p as one frame
+func (fw *frameWriter) Write(p []byte) (n int, err error) {
+	if _, err = fw.w.Write(fw.encode(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// newFrameScanner returns scanner which splits processor stdout into messages.
+// Messages bigger than maxSize are skipped
+func newFrameScanner(r io.Reader, name string, maxSize int) (*bufio.Scanner, error) {
+	f, err := getFraming(name)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize <= 0 {
+		maxSize = defaultMaxMessageSize
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer([]byte{}, maxSize+f.overhead)
+	scanner.Split(f.split(maxSize))
+	return scanner, nil
+}
+
+func encodeNDJSON(msg []byte) []byte {
+	return append(append(make([]byte, 0, len(msg)+1), msg...), '\n')
+}
+
+func encodeLengthPrefixed(msg []byte) []byte {
+	frame := make([]byte, lengthPrefixSize, lengthPrefixSize+len(msg))
+	binary.BigEndian.PutUint32(frame, uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+func encodeNetstring(msg []byte) []byte {
+	frame := strconv.AppendInt(make([]byte, 0, len(msg)+netstringHeaderSize+1), int64(len(msg)), 10)
+	frame = append(frame, ':')
+	frame = append(frame, msg...)
+	return append(frame, ',')
+}
+
+// splitNDJSON splits input by new lines and drops lines longer than maxSize
+func splitNDJSON(maxSize int) bufio.SplitFunc {
+	skipping := false
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		i := bytes.IndexByte(data, '\n')
+		if skipping {
+			if i < 0 {
+				return len(data), nil, nil
+			}
+			skipping = false
+			return i + 1, nil, nil
+		}
+		if i >= 0 {
+			if i > maxSize {
+				logOversized(i, maxSize)
+				return i + 1, nil, nil
+			}
+			return i + 1, bytes.TrimSuffix(data[:i], []byte{'\r'}), nil
+		}
+		if len(data) > maxSize {
+			logOversized(len(data), maxSize)
+			skipping = !atEOF
+			return len(data), nil, nil
+		}
+		if atEOF {
+			return len(data), bytes.TrimSuffix(data, []byte{'\r'}), nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// splitLengthPrefixed reads frames with 4 bytes big-endian length header
+func splitLengthPrefixed(maxSize int) bufio.SplitFunc {
+	skip := 0
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if skip > 0 {
+			if len(data) == 0 && atEOF {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			n := skip
+			if n > len(data) {
+				n = len(data)
+			}
+			skip -= n
+			return n, nil, nil
+		}
+		if len(data) < lengthPrefixSize {
+			if atEOF && len(data) > 0 {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			return 0, nil, nil
+		}
+		size := int(binary.BigEndian.Uint32(data))
+		if size > maxSize {
+			logOversized(size, maxSize)
+			skip = size
+			return lengthPrefixSize, nil, nil
+		}
+		if len(data) < lengthPrefixSize+size {
+			if atEOF {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			return 0, nil, nil
+		}
+		return lengthPrefixSize + size, data[lengthPrefixSize : lengthPrefixSize+size], nil
+	}
+}
+
+// splitNetstring reads frames in netstring format: "<len>:<data>,"
+func splitNetstring(maxSize int) bufio.SplitFunc {
+	skip := 0
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if skip > 0 {
+			if len(data) == 0 && atEOF {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			n := skip
+			if n > len(data) {
+				n = len(data)
+			}
+			skip -= n
+			return n, nil, nil
+		}
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		i := bytes.IndexByte(data, ':')
+		if i < 0 {
+			if len(data) > netstringHeaderSize {
+				return 0, nil, fmt.Errorf("netstring: invalid length header %q", data[:netstringHeaderSize])
+			}
+			if atEOF {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			return 0, nil, nil
+		}
+		size, err := strconv.Atoi(string(data[:i]))
+		if err != nil || size < 0 {
+			return 0, nil, fmt.Errorf("netstring: invalid length header %q", data[:i])
+		}
+		if size > maxSize {
+			logOversized(size, maxSize)
+			skip = size + 1
+			return i + 1, nil, nil
+		}
+		end := i + 1 + size
+		if len(data) <= end {
+			if atEOF {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			return 0, nil, nil
+		}
+		if data[end] != ',' {
+			return 0, nil, fmt.Errorf("netstring: missing trailing comma")
+		}
+		return end + 1, data[i+1 : end], nil
+	}
+}
+
+func logOversized(size, maxSize int) {
+	logger.Log.Warnf("Processor message of %d bytes exceeds MAX_MESSAGE_SIZE (%d bytes). SKIPPED.", size, maxSize)
+}
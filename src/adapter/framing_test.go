@@ -0,0 +1,100 @@
+package adapter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	setLog(new(writer))
+	messages := []string{`{"topic":"a"}`, "{\n  \"topic\": \"b\"\n}", ""}
+	testCases := []struct {
+		name    string
+		framing string
+		want    []string
+	}{
+		{"Test ndjson framing", framingNDJSON, []string{`{"topic":"a"}`, "{", `  "topic": "b"`, "}", ""}},
+		{"Test length-prefixed framing", framingLengthPrefixed, messages},
+		{"Test netstring framing", framingNetstring, messages},
+		{"Test default framing", "", []string{`{"topic":"a"}`, "{", `  "topic": "b"`, "}", ""}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := newFrameWriter(&buf, tc.framing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, msg := range messages {
+				w.Write([]byte(msg))
+			}
+			scanner, err := newFrameScanner(&buf, tc.framing, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for scanner.Scan() {
+				got = append(got, scanner.Text())
+			}
+			if scanner.Err() != nil {
+				t.Fatal(scanner.Err())
+			}
+			if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+				t.Errorf("unexpected result: %q", got)
+			}
+		})
+	}
+}
+
+func TestFrameScannerSkipsOversized(t *testing.T) {
+	wr := new(writer)
+	setLog(wr)
+	big := strings.Repeat("x", 64)
+	for _, name := range []string{framingNDJSON, framingLengthPrefixed, framingNetstring} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, _ := newFrameWriter(&buf, name)
+			w.Write([]byte("first"))
+			w.Write([]byte(big))
+			w.Write([]byte("last"))
+			scanner, _ := newFrameScanner(&buf, name, 16)
+			var got []string
+			for scanner.Scan() {
+				got = append(got, scanner.Text())
+			}
+			if strings.Join(got, "|") != "first|last" {
+				t.Errorf("unexpected result: %q, err: %v", got, scanner.Err())
+			}
+			if !strings.Contains(wr.data, "exceeds MAX_MESSAGE_SIZE") {
+				t.Errorf("unexpected result, got: %q", wr.data)
+			}
+		})
+	}
+}
+
+func TestFrameScannerErrors(t *testing.T) {
+	setLog(new(writer))
+	testCases := []struct {
+		name    string
+		framing string
+		input   string
+	}{
+		{"Test truncated length-prefixed frame", framingLengthPrefixed, "\x00\x00\x00\x05ab"},
+		{"Test bad netstring length", framingNetstring, "x:abc,"},
+		{"Test netstring without comma", framingNetstring, "3:abc;"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scanner, _ := newFrameScanner(strings.NewReader(tc.input), tc.framing, 0)
+			for scanner.Scan() {
+			}
+			if scanner.Err() == nil {
+				t.Error("Expected not <nil> error")
+			}
+		})
+	}
+	if _, err := getFraming("xml"); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+}
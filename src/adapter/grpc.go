@@ -0,0 +1,160 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/mqtt"
+	"mqtt-adapter/src/processorpb"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errNotConnected = errors.New("processor is not connected")
+
+// grpcTransport sends events to currently open Exchange stream
+type grpcTransport struct {
+	mu     sync.Mutex
+	stream processorpb.Processor_ExchangeClient
+}
+
+// send sends event to the processor, gRPC streams don't allow concurrent Send calls
+func (g *grpcTransport) send(event *processorpb.AdapterEvent) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stream == nil {
+		return errNotConnected
+	}
+	return g.stream.Send(event)
+}
+
+func (g *grpcTransport) attach(stream processorpb.Processor_ExchangeClient) {
+	g.mu.Lock()
+	g.stream = stream
+	g.mu.Unlock()
+}
+
+func (g *grpcTransport) detach() {
+	g.mu.Lock()
+	g.stream = nil
+	g.mu.Unlock()
+}
+
+// Write sends message encoded by encodeMessage to the processor
+func (g *grpcTransport) Write(p []byte) (int, error) {
+	msg := new(processorpb.Message)
+	if err := proto.Unmarshal(p, msg); err != nil {
+		return 0, err
+	}
+	if err := g.send(&processorpb.AdapterEvent{Event: &processorpb.AdapterEvent_Message{Message: msg}}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// encodeMessage encodes MQTT message as processor Message, so it can be queued
+func encodeMessage(msg mqtt.Received) []byte {
+	data, _ := proto.Marshal(&processorpb.Message{
+		Topic:     msg.Topic,
+		Payload:   msg.Payload,
+		Qos:       uint32(msg.QoS),
+		Retained:  msg.Retained,
+		Duplicate: msg.Duplicate,
+		MessageId: uint32(msg.MessageID),
+	})
+	return data
+}
+
+// runGRPC launches non-bridge mode with gRPC processor
+func (c *client) runGRPC() {
+	defer c.close()
+
+	conn, err := grpc.Dial(config.Config.ProcessorGRPC, grpc.WithInsecure())
+	if err != nil {
+		logger.Log.Errorf("Cannot connect to processor on %s: %v", config.Config.ProcessorGRPC, err)
+		return
+	}
+	defer conn.Close()
+
+	transport := new(grpcTransport)
+	q, err := c.newInboundQueue(func() { conn.Close() })
+	if err != nil {
+		logger.Log.Error(err)
+		return
+	}
+	defer q.close()
+	go q.drain(transport)
+	processor := writerFunc(func(p []byte) (int, error) {
+		return q.Write(encodeMessage(mqtt.Received{Payload: p}))
+	})
+	defer c.startSchedules(processor).Stop()
+	c.rpc = newRPC(c.listener, processor, config.Config.RPCTimeout)
+	deliver := c.validatingFunc(func(msg mqtt.Received) {
+		c.rpc.settle(msg.Payload)
+		if _, err := q.Write(encodeMessage(msg)); err != nil {
+			logger.Log.Warnf("Cannot pass MQTT message to processor: %v", err)
+		}
+	})
+	subs := c.newSubscriptions(func(topic string) { c.listener.SubscribeFunc(topic, deliver) })
+	c.rpc.subscribed = subs.has
+	c.control = &control{acl: c.acl, subs: subs, processor: processor}
+	c.listen(subs)
+	defer c.watchSubscriptions(subs)()
+	c.exchange(processorpb.NewProcessorClient(conn), transport)
+}
+
+// exchange opens Exchange stream and opens it again when the stream is broken until the connection is closed
+func (c *client) exchange(processor processorpb.ProcessorClient, transport *grpcTransport) {
+	backoff := reconnectMinBackoff
+	for {
+		stream, err := processor.Exchange(context.Background())
+		if status.Code(err) == codes.Canceled {
+			return
+		}
+		if err != nil {
+			logger.Log.Warnf("Cannot open stream to processor: %v. Retry in %s", err, backoff)
+			backoff = sleepBackoff(backoff)
+			continue
+		}
+		transport.attach(stream)
+		err = c.serveStream(stream, transport)
+		transport.detach()
+		if status.Code(err) == codes.Canceled {
+			return
+		}
+		if err == nil {
+			backoff = reconnectMinBackoff
+			logger.Log.Infof("Processor closed stream. Reopen in %s", backoff)
+		} else {
+			logger.Log.Warnf("Processor stream is broken: %v. Retry in %s", err, backoff)
+		}
+		backoff = sleepBackoff(backoff)
+	}
+}
+
+// serveStream publishes envelopes requested by the processor and acks every request
+func (c *client) serveStream(stream processorpb.Processor_ExchangeClient, transport *grpcTransport) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ack := &processorpb.Ack{Id: req.Id}
+		if err = c.publish(string(req.Envelope)); err != nil {
+			ack.Error = err.Error()
+		}
+		if err = transport.send(&processorpb.AdapterEvent{Event: &processorpb.AdapterEvent_Ack{Ack: ack}}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package adapter
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/mqtt"
+	"mqtt-adapter/src/processorpb"
+
+	"google.golang.org/grpc"
+)
+
+// testProcessor sends publish requests and collects events from the adapter
+type testProcessor struct {
+	requests []*processorpb.PublishRequest
+	events   chan *processorpb.AdapterEvent
+}
+
+func (p *testProcessor) Exchange(stream processorpb.Processor_ExchangeServer) error {
+	for _, req := range p.requests {
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+	}
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		p.events <- event
+	}
+}
+
+func TestClient_exchange(t *testing.T) {
+	setLog(new(writer))
+	loadConf()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor := &testProcessor{
+		requests: []*processorpb.PublishRequest{
+			{Id: "1", Envelope: []byte(`{"topic":"test"}`)},
+			{Id: "2", Envelope: []byte(`{"topic":`)},
+			{Id: "3", Envelope: []byte(`{"topic":"svc/a/req","reply_to":"svc/b/replies","correlation_id":"1"}`)},
+		},
+		events: make(chan *processorpb.AdapterEvent, 10),
+	}
+	server := grpc.NewServer()
+	processorpb.RegisterProcessorServer(server, processor)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := new(recordPublisher)
+	sub := &replySubscriber{handlers: map[string]func(msg mqtt.Received){}}
+	cl := &client{listener: sub, publisher: pub, rpc: newRPC(sub, new(processorWriter), time.Minute)}
+	transport := new(grpcTransport)
+	done := make(chan struct{})
+	go func() {
+		cl.exchange(processorpb.NewProcessorClient(conn), transport)
+		close(done)
+	}()
+	// exchange returns when the connection is closed
+	defer func() {
+		conn.Close()
+		<-done
+	}()
+
+	acks := map[string]string{}
+	for len(acks) < 3 {
+		select {
+		case event := <-processor.events:
+			ack := event.GetAck()
+			if ack == nil {
+				t.Fatalf("unexpected event: %v", event)
+			}
+			acks[ack.Id] = ack.Error
+		case <-time.After(time.Second * 5):
+			t.Fatal("acks were not received")
+		}
+	}
+	if acks["1"] != "" || acks["2"] == "" || acks["3"] != "" {
+		t.Errorf("unexpected acks: %v", acks)
+	}
+	if msgs := pub.messages(); len(msgs) != 2 || msgs[0] != `{"topic":"test"}` {
+		t.Errorf("unexpected result: %q", msgs)
+	}
+	if sub.handler("svc/b/replies") == nil {
+		t.Errorf("reply topic is not subscribed: %v", sub.handlers)
+	}
+
+	if _, err = transport.Write(encodeMessage(mqtt.Received{Topic: "default/test", Payload: []byte(`{}`), QoS: 1})); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-processor.events:
+		if msg := event.GetMessage(); msg == nil || msg.Topic != "default/test" || msg.Qos != 1 {
+			t.Errorf("unexpected event: %v", event)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("message was not delivered")
+	}
+}
+
+func TestGRPCTransport_sendWithoutStream(t *testing.T) {
+	setLog(new(writer))
+	transport := new(grpcTransport)
+	if err := transport.send(&processorpb.AdapterEvent{}); err != errNotConnected {
+		t.Errorf("unexpected result: %v", err)
+	}
+	if _, err := transport.Write(encodeMessage(mqtt.Received{Topic: "test"})); err != errNotConnected {
+		t.Errorf("unexpected result: %v", err)
+	}
+}
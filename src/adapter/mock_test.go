@@ -1,9 +1,13 @@
 package adapter
 
 import (
+	"encoding/json"
+	"errors"
 	"io"
+	"sync"
 
 	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/mqtt"
 
 	"github.com/sirupsen/logrus"
 	"github.com/surgemq/surgemq/service"
@@ -11,6 +15,8 @@ import (
 
 type TestSubscriber struct {
 	needPanic bool
+	// bridged replaces default messages of SubscribeBridge
+	bridged []string
 }
 
 func (s TestSubscriber) Subscribe(topic string, writer io.Writer) {}
@@ -19,19 +25,89 @@ func (s TestSubscriber) SubscribeBridge(topic string, msgChan chan<- string) {
 	if s.needPanic {
 		panic("test Panic")
 	}
+	if s.bridged != nil {
+		for _, msg := range s.bridged {
+			msgChan <- msg
+		}
+		close(msgChan)
+		return
+	}
 	msgChan <- `{"topic":"test"}`
 	msgChan <- `{"topic":123}`
 	close(msgChan)
 }
 
+func (s TestSubscriber) SubscribeFunc(topic string, handler func(msg mqtt.Received)) {}
+
+func (s TestSubscriber) Unsubscribe(topic string) {}
+
 func (s TestSubscriber) Disconnect() {}
 
+// recordSubscriber remembers subscribed and unsubscribed topics
+type recordSubscriber struct {
+	TestSubscriber
+	mu           sync.Mutex
+	subscribed   []string
+	unsubscribed []string
+}
+
+func (s *recordSubscriber) Subscribe(topic string, writer io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribed = append(s.subscribed, topic)
+}
+
+func (s *recordSubscriber) Unsubscribe(topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unsubscribed = append(s.unsubscribed, topic)
+}
+
+func (s *recordSubscriber) topics() (subscribed, unsubscribed []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.subscribed...), append([]string(nil), s.unsubscribed...)
+}
+
 type TestPublisher struct{}
 
 func (p TestPublisher) Publish(msg string) error { return nil }
 
+func (p TestPublisher) PublishRaw(topic string, payload []byte, retained bool) error { return nil }
+
 func (p TestPublisher) Disconnect() {}
 
+// recordPublisher remembers published messages
+type recordPublisher struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (p *recordPublisher) Publish(msg string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !json.Valid([]byte(msg)) {
+		return errors.New("invalid JSON")
+	}
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+func (p *recordPublisher) PublishRaw(topic string, payload []byte, retained bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.msgs = append(p.msgs, topic+" "+string(payload))
+	return nil
+}
+
+func (p *recordPublisher) Disconnect() {}
+
+func (p *recordPublisher) messages() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.msgs...)
+}
+
 type writer struct {
 	data string
 }
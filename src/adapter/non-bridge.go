@@ -2,67 +2,180 @@ package adapter
 
 import (
 	"bufio"
-	"io"
 	"fmt"
+	"io"
 	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
 	"syscall"
 
 	"mqtt-adapter/src/config"
 	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/mqtt"
+)
 
+const (
+	// processorInstance is a name of environment with index of processor instance
+	processorInstance = "PROCESSOR_INSTANCE"
+	// processorQueue is a name of queue between MQTT subscription and processor
+	processorQueue = "processor"
 )
 
+// newInboundQueue creates queue of MQTT messages to processor and exposes its metrics.
+// With disconnect policy MQTT listener is disconnected and stop is called once the queue overflows
+func (c *client) newInboundQueue(stop func()) (*queue, error) {
+	q, err := newQueue(processorQueue, config.Config.QueueSize, config.Config.QueueOverflow, func() {
+		c.listener.Disconnect()
+		stop()
+	})
+	if err != nil {
+		return nil, err
+	}
+	q.expose()
+	return q, nil
+}
+
 // run launches non-bridge mode
 func (c *client) run() {
-	outPipe, errPipe, inPipe, err := c.getPipes()
+	defer c.close()
+
+	p := newPool(config.Config.ProcessorInstances, config.Config.ProcessorHashKey)
+	q, err := c.newInboundQueue(p.kill)
 	if err != nil {
+		logger.Log.Error(err)
 		return
 	}
+	defer q.close()
+	go q.drain(p)
+	// processor output is read as soon as an instance starts, so rpc and control have to be ready before
+	c.rpc = newRPC(c.listener, q, config.Config.RPCTimeout)
+	processor := c.rpc.passing(q)
+	subs := c.newSubscriptions(func(topic string) { c.subscribe(processor, topic) })
+	c.rpc.subscribed = subs.has
+	c.control = &control{acl: c.acl, subs: subs, processor: q}
+
+	defer p.kill()
+	for _, w := range p.workers {
+		cmd := c.command
+		if w.id > 0 {
+			cmd = cloneCommand(c.command)
+		}
+		if err := c.start(w, cmd); err != nil {
+			logger.Log.Errorf("Cannot start processor instance %d: %v", w.id, err)
+			p.stop()
+			return
+		}
+	}
+	defer c.startSchedules(q).Stop()
+	c.listen(subs)
+	defer c.watchSubscriptions(subs)()
+
+	// wait for all Processes close
+	var wg sync.WaitGroup
+	for _, w := range p.workers {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			c.supervise(p, w)
+		}(w)
+	}
+	wg.Wait()
+}
 
-	defer func() {
-		outPipe.Close()
-		errPipe.Close()
-		inPipe.Close()
-		c.close()
-	}()
+// start spawns processor instance and starts reading its stdOut and stdErr
+func (c *client) start(w *worker, cmd *exec.Cmd) error {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", processorInstance, w.id))
 
-	scanner := bufio.NewScanner(outPipe)
-	scanner.Buffer([]byte{}, math.MaxInt32)
+	outPipe, errPipe, inPipe, err := getPipes(cmd)
+	if err != nil {
+		return err
+	}
+	scanner, err := newFrameScanner(outPipe, config.Config.Framing, config.Config.MaxMessageSize)
+	if err != nil {
+		logger.Log.Error(err)
+		return err
+	}
+	stdIn, err := newFrameWriter(inPipe, config.Config.Framing)
+	if err != nil {
+		logger.Log.Error(err)
+		return err
+	}
 	scannerErr := bufio.NewScanner(errPipe)
 	scannerErr.Buffer([]byte{}, math.MaxInt32)
 	logger.Log.Infof("Spawning processor: %s", config.Config.ServiceProcessor)
-	if err = c.command.Start(); err != nil {
+	if err = cmd.Start(); err != nil {
 		logger.Log.Error(err)
-		return
-	}
-
-	pid := c.command.Process.Pid
-	logger.Log.Infof("Process with PID: %d has been started", pid)
-
-	defer func() {
-		syscall.Kill(pid, 1)
-	}()
-
-	if c.topic != "" {
-		topic := fmt.Sprintf("%s/%s", config.Config.NamespaceListener, c.topic)
-		go c.subscribe(inPipe, topic)
-	} else {
-		logger.Log.Error("Cannot start Listener: topic is not initialized")
+		return err
 	}
+	logger.Log.Infof("Process with PID: %d has been started", cmd.Process.Pid)
 
+	var readers sync.WaitGroup
+	readers.Add(2)
 	// read stdOut of the Processor
 	go func() {
+		defer readers.Done()
 		for scanner.Scan() {
-			go c.publish(scanner.Text())
+			// instance is waited for after all its messages are published
+			readers.Add(1)
+			go func(msg string) {
+				defer readers.Done()
+				c.publish(msg)
+			}(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			logger.Log.Errorf("Reading processor stdout failed: %v", err)
 		}
 	}()
-
 	// read stdErr of the Processor
-	go readStdErr(scannerErr)
+	go func() {
+		defer readers.Done()
+		readStdErr(scannerErr)
+	}()
+
+	w.attach(cmd, stdIn, &readers)
+	return nil
+}
+
+// supervise waits for processor instance exits and respawns it if PROCESSOR_RESTART is set.
+// Instances of stopped pool, e.g. by QUEUE_OVERFLOW=disconnect, are not respawned
+func (c *client) supervise(p *pool, w *worker) {
+	backoff := reconnectMinBackoff
+	for {
+		cmd := w.wait()
+		if !config.Config.ProcessorRestart || p.isStopped() {
+			return
+		}
+		for {
+			logger.Log.Warnf("Processor instance %d exited. Restart in %s", w.id, backoff)
+			backoff = sleepBackoff(backoff)
+			started, err := p.restart(func() error { return c.start(w, cloneCommand(cmd)) })
+			if !started {
+				return
+			}
+			if err == nil {
+				break
+			}
+		}
+		backoff = reconnectMinBackoff
+	}
+}
 
-	// wait for Process closes
-	err = c.command.Wait()
-	logError(c.command.Process.Pid, err)
+// cloneCommand returns not started copy of cmd
+func cloneCommand(cmd *exec.Cmd) *exec.Cmd {
+	clone := exec.Command(cmd.Path, cmd.Args[1:]...)
+	clone.Dir = cmd.Dir
+	for _, env := range cmd.Env {
+		if strings.HasPrefix(env, processorInstance+"=") {
+			continue
+		}
+		clone.Env = append(clone.Env, env)
+	}
+	return clone
 }
 
 func logError(pid int, err error) {
@@ -72,18 +185,18 @@ func logError(pid int, err error) {
 }
 
 // getPipes returns stdOut, stdErr and stdIn of executed process
-func (c *client) getPipes() (outPipe, errPipe io.ReadCloser, inPipe io.WriteCloser, err error) {
-	outPipe, err = c.command.StdoutPipe()
+func getPipes(cmd *exec.Cmd) (outPipe, errPipe io.ReadCloser, inPipe io.WriteCloser, err error) {
+	outPipe, err = cmd.StdoutPipe()
 	if err != nil {
 		logger.Log.Errorf("Error obtaining StdOut: %s", err.Error())
 		return nil, nil, nil, err
 	}
-	errPipe, err = c.command.StderrPipe()
+	errPipe, err = cmd.StderrPipe()
 	if err != nil {
 		logger.Log.Errorf("Error obtaining StdErr: %s", err.Error())
 		return nil, nil, nil, err
 	}
-	inPipe, err = c.command.StdinPipe()
+	inPipe, err = cmd.StdinPipe()
 	if err != nil {
 		logger.Log.Errorf("Error obtaining StdIn: %s", err.Error())
 		return nil, nil, nil, err
@@ -91,20 +204,44 @@ func (c *client) getPipes() (outPipe, errPipe io.ReadCloser, inPipe io.WriteClos
 	return
 }
 
-// subscribe listens to MQTT server
+// subscribe listens to MQTT server, messages are validated by schema of their topic if SCHEMAS are set
 func (c *client) subscribe(w io.Writer, topic string) {
-	// for {
-	c.listener.Subscribe(topic, w)
-	// }
+	if len(c.schemas) == 0 {
+		c.listener.Subscribe(topic, w)
+		return
+	}
+	c.listener.SubscribeFunc(topic, c.validatingFunc(func(msg mqtt.Received) {
+		if _, err := w.Write(msg.Payload); err != nil {
+			logger.Log.Warnf("Cannot pass MQTT message to processor: %v", err)
+		}
+	}))
 }
 
-func (c *client) publish(msg string) {
-	logger.Log.Debugf("processor_stdout_message: %s", msg)
-	c.publisher.Publish(msg)
+// publish handles envelope from processor in every mode: applies control command or publishes it and tracks
+// its reply. The error tells why the envelope was rejected or not published
+func (c *client) publish(msg string) error {
+	logger.Log.Debugf("processor_message: %s", msg)
+	if c.control != nil {
+		if handled, err := c.control.handle([]byte(msg)); handled {
+			return err
+		}
+	}
+	if err := c.checkOutbound(msg); err != nil {
+		return err
+	}
+	if c.rpc != nil {
+		c.rpc.track([]byte(msg))
+	}
+	return c.publisher.Publish(msg)
 }
 
 func readStdErr(scanner *bufio.Scanner) {
 	for scanner.Scan() {
-		go logger.Log.Errorf("Processor ERROR event emitted: %s", scanner.Text())
+		logger.Log.Errorf("Processor ERROR event emitted: %s", scanner.Text())
 	}
 }
+
+// killProcess sends SIGHUP to the process
+func killProcess(cmd *exec.Cmd) {
+	syscall.Kill(cmd.Process.Pid, 1)
+}
@@ -106,7 +106,7 @@ func TestClientGetPipes(t *testing.T) {
 			if tc.outPipe {
 				cmd.Stdout = os.Stderr
 			}
-			o, e, i, err := cl.getPipes()
+			o, e, i, err := getPipes(cl.command)
 			if tc.needErr {
 				if err == nil || o != nil || e != nil || i != nil {
 					t.Error("Expected not <nil> error")
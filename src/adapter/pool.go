@@ -0,0 +1,177 @@
+package adapter
+
+import (
+	"errors"
+	"hash/fnv"
+	"io"
+	"os/exec"
+	"sync"
+
+	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/mqtt"
+)
+
+var errNotRunning = errors.New("processor instance is not running")
+
+// worker is a single processor instance
+type worker struct {
+	id      int
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.Writer
+	readers *sync.WaitGroup
+}
+
+// attach makes cmd the running command of the instance
+func (w *worker) attach(cmd *exec.Cmd, stdin io.Writer, readers *sync.WaitGroup) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cmd = cmd
+	w.stdin = stdin
+	w.readers = readers
+}
+
+// Write writes message to stdIn of the instance. The lock is not held while writing,
+// so a processor which stops reading can still be killed
+func (w *worker) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	stdin := w.stdin
+	w.mu.Unlock()
+	if stdin == nil {
+		return 0, errNotRunning
+	}
+	return stdin.Write(p)
+}
+
+// wait waits for the instance exits and returns its command
+func (w *worker) wait() *exec.Cmd {
+	w.mu.Lock()
+	cmd, readers := w.cmd, w.readers
+	w.mu.Unlock()
+
+	// all reads from pipes have to be completed before Wait
+	readers.Wait()
+	err := cmd.Wait()
+	logError(cmd.Process.Pid, err)
+
+	w.mu.Lock()
+	w.stdin = nil
+	w.mu.Unlock()
+	return cmd
+}
+
+// kill stops the instance if it is still running
+func (w *worker) kill() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stdin != nil && w.cmd.Process != nil {
+		killProcess(w.cmd)
+	}
+}
+
+// pool distributes messages between processor instances
+type pool struct {
+	workers []*worker
+	hashKey string
+	mu      sync.Mutex
+	next    int
+
+	// stateMu serializes restarts of instances with stopping the pool
+	stateMu sync.Mutex
+	stopped bool
+}
+
+// newPool creates pool of instances, messages with the same value of hashKey go to the same instance
+func newPool(instances int, hashKey string) *pool {
+	if instances < 1 {
+		instances = 1
+	}
+	p := &pool{hashKey: hashKey}
+	for i := 0; i < instances; i++ {
+		p.workers = append(p.workers, &worker{id: i})
+	}
+	return p
+}
+
+// Write writes message to the picked instance. Messages without hash key go to the next running instance
+// if the picked one is down, messages with the key are dropped to keep their order
+func (p *pool) Write(msg []byte) (n int, err error) {
+	start, keyed := p.pick(msg)
+	if keyed {
+		return p.workers[start].Write(msg)
+	}
+	for i := range p.workers {
+		w := p.workers[(start+i)%len(p.workers)]
+		if n, err = w.Write(msg); err != errNotRunning {
+			return n, err
+		}
+	}
+	logger.Log.Warnf("No running processor instance, message of %d bytes dropped", len(msg))
+	return 0, errNotRunning
+}
+
+// pick returns index of instance by hash of the key or round-robin, keyed reports if the message has the key
+func (p *pool) pick(msg []byte) (i int, keyed bool) {
+	if len(p.workers) == 1 {
+		return 0, false
+	}
+	if p.hashKey != "" {
+		if key, ok := mqtt.LookupKey(msg, p.hashKey); ok {
+			h := fnv.New32a()
+			h.Write(key)
+			return int(h.Sum32() % uint32(len(p.workers))), true
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i = p.next
+	p.next = (p.next + 1) % len(p.workers)
+	return i, false
+}
+
+// kill stops all running instances, stopped pool doesn't restart them
+func (p *pool) kill() {
+	p.markStopped()
+	for _, w := range p.workers {
+		w.kill()
+	}
+}
+
+// stop kills running instances and waits for them to exit
+func (p *pool) stop() {
+	p.markStopped()
+	for _, w := range p.workers {
+		w.mu.Lock()
+		running := w.stdin != nil
+		w.mu.Unlock()
+		if running {
+			w.kill()
+			w.wait()
+		}
+	}
+}
+
+// markStopped marks the pool stopped, a restart in progress completes before
+func (p *pool) markStopped() {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.stopped = true
+}
+
+// isStopped reports if the pool is stopped
+func (p *pool) isStopped() bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.stopped
+}
+
+// restart calls start unless the pool is stopped, false is returned if it is stopped.
+// An instance started by restart is killed by kill called later
+func (p *pool) restart(start func() error) (bool, error) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if p.stopped {
+		return false, nil
+	}
+	return true, start()
+}
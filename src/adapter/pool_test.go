@@ -0,0 +1,147 @@
+package adapter
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/config"
+)
+
+func TestPool_pick(t *testing.T) {
+	p := newPool(3, "payload.device")
+	for i := 0; i < 6; i++ {
+		if got, keyed := p.pick([]byte(`{}`)); got != i%3 || keyed {
+			t.Errorf("unexpected round-robin result: %d, %v", got, keyed)
+		}
+	}
+	first, _ := p.pick([]byte(`{"payload":{"device":"42"}}`))
+	for i := 0; i < 5; i++ {
+		if got, keyed := p.pick([]byte(`{"topic":"a","payload":{"device":"42"}}`)); got != first || !keyed {
+			t.Errorf("unexpected hash result: %d, %v, expected: %d", got, keyed, first)
+		}
+	}
+	if got, _ := newPool(0, "").pick([]byte(`{}`)); got != 0 {
+		t.Errorf("unexpected result: %d", got)
+	}
+}
+
+func TestPool_Write(t *testing.T) {
+	wr := new(writer)
+	setLog(wr)
+	p := newPool(2, "")
+	if _, err := p.Write([]byte("secret payload")); err != errNotRunning || strings.Contains(wr.data, "secret payload") {
+		t.Errorf("unexpected result: %v, %q", err, wr.data)
+	}
+	var buf bytes.Buffer
+	p.workers[1].stdin = &buf
+	for i := 0; i < 2; i++ {
+		if _, err := p.Write([]byte("test")); err != nil {
+			t.Error(err)
+		}
+	}
+	if buf.String() != "testtest" {
+		t.Errorf("unexpected result: %q", buf.String())
+	}
+
+	// keyed messages are not moved to another instance
+	p = newPool(2, "device")
+	p.workers[0].stdin, p.workers[1].stdin = &buf, &buf
+	msg := []byte(`{"device":"42"}`)
+	i, _ := p.pick(msg)
+	p.workers[i].stdin = nil
+	buf.Reset()
+	if _, err := p.Write(msg); err != errNotRunning || buf.Len() != 0 {
+		t.Errorf("unexpected result: %v, %q", err, buf.String())
+	}
+}
+
+func TestClient_runInstances(t *testing.T) {
+	wr := new(writer)
+	setLog(wr)
+	loadConf()
+	config.Config.ProcessorInstances = 3
+
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	cl := &client{
+		listener:  TestSubscriber{},
+		publisher: TestPublisher{},
+		command:   exec.Command("true"),
+		topic:     "test_token",
+	}
+	cl.run()
+	if strings.Contains(wr.data, "level=error") {
+		t.Errorf("unexpected result, got: %q", wr.data)
+	}
+
+	clone := cloneCommand(exec.Command("ls", "-la"))
+	if len(clone.Args) != 2 || clone.Args[1] != "-la" || clone.Process != nil {
+		t.Errorf("unexpected result: %v", clone.Args)
+	}
+}
+
+func TestWorker_killBlockedWrite(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	cmd := exec.Command("sleep", "5")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// nobody reads the pipe, so the write blocks like write to a full stdin
+	stdout, stdin := io.Pipe()
+	defer stdout.Close()
+	w := &worker{}
+	w.attach(cmd, stdin, new(sync.WaitGroup))
+	go w.Write([]byte("test"))
+	time.Sleep(50 * time.Millisecond)
+
+	killed := make(chan struct{})
+	go func() {
+		w.kill()
+		close(killed)
+	}()
+	select {
+	case <-killed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("kill is blocked by write")
+	}
+	cmd.Wait()
+}
+
+func TestClient_superviseStoppedPool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	setLog(new(writer))
+	loadConf()
+	config.Config.ProcessorRestart = true
+	defer func() { config.Config.ProcessorRestart = false }()
+	cl := &client{listener: TestSubscriber{}, publisher: TestPublisher{}}
+	p := newPool(1, "")
+	if err := cl.start(p.workers[0], exec.Command("sleep", "5")); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		cl.supervise(p, p.workers[0])
+		close(done)
+	}()
+	p.kill()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("killed instance of stopped pool is restarted")
+	}
+	if started, _ := p.restart(func() error { return nil }); started {
+		t.Error("stopped pool restarts instance")
+	}
+}
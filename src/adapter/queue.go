@@ -0,0 +1,166 @@
+package adapter
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"sync"
+
+	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/metrics"
+)
+
+const (
+	// overflowBlock blocks MQTT callback until there is a room in the queue
+	overflowBlock = "block"
+	// overflowDropOldest removes the oldest queued message
+	overflowDropOldest = "drop-oldest"
+	// overflowDropNewest drops the received message
+	overflowDropNewest = "drop-newest"
+	// overflowDisconnect drops the received message and stops the adapter
+	overflowDisconnect = "disconnect"
+
+	defaultQueueSize = 1000
+)
+
+var errQueueClosed = errors.New("queue is closed")
+
+// queue is a bounded FIFO of messages between MQTT subscription and processor
+type queue struct {
+	name       string
+	mu         sync.Mutex
+	notEmpty   *sync.Cond
+	notFull    *sync.Cond
+	items      [][]byte
+	size       int
+	policy     string
+	closed     bool
+	dropped    int
+	onOverflow func()
+}
+
+// newQueue creates queue of size messages with specified overflow policy.
+// onOverflow is called once the queue overflows with disconnect policy.
+// name is a prefix of the queue metrics, depth is exposed by expose
+func newQueue(name string, size int, policy string, onOverflow func()) (*queue, error) {
+	switch policy {
+	case "":
+		policy = overflowBlock
+	case overflowBlock, overflowDropOldest, overflowDropNewest, overflowDisconnect:
+	default:
+		return nil, fmt.Errorf("unknown QUEUE_OVERFLOW policy %q", policy)
+	}
+	if size < 1 {
+		size = defaultQueueSize
+	}
+	q := &queue{name: name, size: size, policy: policy, onOverflow: onOverflow}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q, nil
+}
+
+// expose publishes depth of the queue in metrics, a queue of the same name exposed before is replaced
+func (q *queue) expose() {
+	metrics.Stats.Set(q.name+"_queue_depth", expvar.Func(func() interface{} { return q.depth() }))
+}
+
+// Write puts copy of message to the queue
+func (q *queue) Write(p []byte) (n int, err error) {
+	msg := append([]byte(nil), p...)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, errQueueClosed
+	}
+	if len(q.items) >= q.size {
+		metrics.Stats.Add(q.name+"_queue_overflows", 1)
+		switch q.policy {
+		case overflowBlock:
+			for len(q.items) >= q.size && !q.closed {
+				q.notFull.Wait()
+			}
+			if q.closed {
+				return 0, errQueueClosed
+			}
+		case overflowDropOldest:
+			q.drop("the oldest message")
+			q.items[0] = nil
+			q.items = q.items[1:]
+		case overflowDropNewest:
+			q.drop("received message")
+			return len(p), nil
+		case overflowDisconnect:
+			logger.Log.Errorf("%s queue is full (%d messages), disconnecting", q.name, q.size)
+			metrics.Stats.Add(q.name+"_queue_dropped", 1)
+			q.closed = true
+			q.notEmpty.Broadcast()
+			q.notFull.Broadcast()
+			if q.onOverflow != nil {
+				go q.onOverflow()
+			}
+			return 0, errQueueClosed
+		}
+	}
+	q.items = append(q.items, msg)
+	q.notEmpty.Signal()
+	return len(p), nil
+}
+
+// drop counts dropped message, the count is logged instead of message content
+func (q *queue) drop(which string) {
+	q.dropped++
+	metrics.Stats.Add(q.name+"_queue_dropped", 1)
+	logger.Log.Debugf("%s queue is full, %s dropped (%d dropped in total)", q.name, which, q.dropped)
+}
+
+// pop waits for the next message, false is returned if the queue is closed
+func (q *queue) pop() ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if len(q.items) == 0 {
+		return nil, false
+	}
+	msg := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	q.notFull.Signal()
+	return msg, true
+}
+
+// drain writes queued messages to w until the queue or the processor transport is closed
+func (q *queue) drain(w io.Writer) {
+	for {
+		msg, ok := q.pop()
+		if !ok {
+			return
+		}
+		_, err := w.Write(msg)
+		if err == errQueueClosed || err == errTransportClosed {
+			return
+		}
+		if err != nil {
+			metrics.Stats.Add(q.name+"_write_errors", 1)
+			logger.Log.Errorf("Cannot deliver message from %s queue: %v", q.name, err)
+		}
+	}
+}
+
+// close stops accepting messages, drain returns once the queue is empty
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// depth returns number of queued messages
+func (q *queue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
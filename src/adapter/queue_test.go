@@ -0,0 +1,148 @@
+package adapter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestNewQueue(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy string
+		fail   bool
+	}{
+		{"Test default policy", "", false},
+		{"Test block", overflowBlock, false},
+		{"Test drop-oldest", overflowDropOldest, false},
+		{"Test drop-newest", overflowDropNewest, false},
+		{"Test disconnect", overflowDisconnect, false},
+		{"Test unknown policy", "ignore", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newQueue("test", 1, tc.policy, nil)
+			if (err != nil) != tc.fail {
+				t.Errorf("unexpected result: %v", err)
+			}
+		})
+	}
+}
+
+func queued(q *queue) string {
+	var msgs []string
+	for _, item := range q.items {
+		msgs = append(msgs, string(item))
+	}
+	return strings.Join(msgs, ",")
+}
+
+func TestQueue_overflow(t *testing.T) {
+	setLog(new(writer))
+	testCases := []struct {
+		name     string
+		policy   string
+		expected string
+		fail     bool
+	}{
+		{"Test drop-oldest", overflowDropOldest, "b,c", false},
+		{"Test drop-newest", overflowDropNewest, "a,b", false},
+		{"Test disconnect", overflowDisconnect, "a,b", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			disconnected := make(chan struct{})
+			q, _ := newQueue("test", 2, tc.policy, func() { close(disconnected) })
+			q.Write([]byte("a"))
+			q.Write([]byte("b"))
+			_, err := q.Write([]byte("c"))
+			if (err != nil) != tc.fail {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if got := queued(q); got != tc.expected {
+				t.Errorf("unexpected result: %q, expected: %q", got, tc.expected)
+			}
+			if tc.fail {
+				select {
+				case <-disconnected:
+				case <-time.After(time.Second):
+					t.Error("onOverflow was not called")
+				}
+			}
+		})
+	}
+}
+
+func TestQueue_dropLog(t *testing.T) {
+	wr := new(writer)
+	setLog(wr)
+	logger.Log.SetLevel(logrus.DebugLevel)
+	q, _ := newQueue("test", 1, overflowDropNewest, nil)
+	q.Write([]byte(`{"password":"first"}`))
+	q.Write([]byte(`{"password":"second"}`))
+	q.Write([]byte(`{"password":"third"}`))
+	if strings.Contains(wr.data, "password") || !strings.Contains(wr.data, "2 dropped in total") {
+		t.Errorf("unexpected log: %q", wr.data)
+	}
+}
+
+func TestQueue_block(t *testing.T) {
+	q, _ := newQueue("test", 1, overflowBlock, nil)
+	q.Write([]byte("a"))
+	written := make(chan struct{})
+	go func() {
+		q.Write([]byte("b"))
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("Write didn't block on full queue")
+	case <-time.After(time.Millisecond * 50):
+	}
+	if msg, ok := q.pop(); !ok || string(msg) != "a" {
+		t.Errorf("unexpected result: %q, %v", msg, ok)
+	}
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("Write wasn't unblocked")
+	}
+	if q.depth() != 1 {
+		t.Errorf("unexpected depth: %d", q.depth())
+	}
+}
+
+func TestQueue_drain(t *testing.T) {
+	setLog(new(writer))
+	q, _ := newQueue("test", 10, overflowBlock, nil)
+	buf := []byte("a")
+	q.Write(buf)
+	buf[0] = 'x'
+	q.Write([]byte("b"))
+	q.close()
+	if _, err := q.Write([]byte("c")); err != errQueueClosed {
+		t.Errorf("unexpected result: %v", err)
+	}
+
+	var out bytes.Buffer
+	q.drain(&out)
+	if out.String() != "ab" {
+		t.Errorf("unexpected result: %q", out.String())
+	}
+
+	// write errors are logged and the queue keeps draining
+	wr := new(writer)
+	setLog(wr)
+	q, _ = newQueue("test", 10, overflowBlock, nil)
+	q.Write([]byte("a"))
+	q.close()
+	q.drain(newPool(1, ""))
+	if !strings.Contains(wr.data, errNotRunning.Error()) {
+		t.Errorf("unexpected result: %q", wr.data)
+	}
+}
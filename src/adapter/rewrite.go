@@ -0,0 +1,159 @@
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+const (
+	// rulePrefix replaces topic prefix, the prefix matches whole topic levels
+	rulePrefix = "prefix"
+	// ruleRegex replaces topic matched by regular expression, $1 in replace is a capture group
+	ruleRegex = "regex"
+	// ruleFilter maps topic matched by MQTT filter, $1 in replace is a value of the first wildcard.
+	// Trailing '/' of replace is dropped if the trailing '#' matches no level
+	ruleFilter = "filter"
+)
+
+// rewriteRule is a rule of bridge topic rewriting as it is set in rules file
+type rewriteRule struct {
+	Type    string `json:"type"`
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+
+	re *regexp.Regexp
+}
+
+// rewrite returns new topic, false is returned if the rule doesn't match the topic
+func (r *rewriteRule) rewrite(topic string) (string, bool) {
+	if r.re == nil {
+		return r.replacePrefix(topic)
+	}
+	match := r.re.FindStringSubmatchIndex(topic)
+	if match == nil {
+		return "", false
+	}
+	newTopic := string(r.re.ExpandString(nil, r.Replace, topic, match))
+	if last := r.re.NumSubexp(); r.Type == ruleFilter && strings.HasSuffix(r.Match, "/#") && match[2*last] < 0 {
+		newTopic = strings.TrimSuffix(newTopic, "/")
+	}
+	return newTopic, true
+}
+
+// replacePrefix replaces prefix of whole topic levels, e.g. dev matches dev and dev/a but not devices
+func (r *rewriteRule) replacePrefix(topic string) (string, bool) {
+	prefix, replace := strings.TrimSuffix(r.Match, "/"), strings.TrimSuffix(r.Replace, "/")
+	var rest string
+	switch {
+	case prefix == "":
+		rest = "/" + topic
+	case topic == prefix:
+	case strings.HasPrefix(topic, prefix+"/"):
+		rest = strings.TrimPrefix(topic, prefix)
+	default:
+		return "", false
+	}
+	if replace == "" {
+		return strings.TrimPrefix(rest, "/"), true
+	}
+	return replace + rest, true
+}
+
+// compile checks the rule and prepares its regular expression
+func (r *rewriteRule) compile() error {
+	var err error
+	switch r.Type {
+	case rulePrefix:
+		return nil
+	case ruleRegex:
+		r.re, err = regexp.Compile(r.Match)
+	case ruleFilter:
+		r.re, err = filterToRegexp(r.Match)
+	default:
+		return fmt.Errorf("unknown rule type %q", r.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s rule %q: %v", r.Type, r.Match, err)
+	}
+	return nil
+}
+
+// filterToRegexp converts MQTT topic filter to regular expression, each wildcard is a capture group
+func filterToRegexp(filter string) (*regexp.Regexp, error) {
+	levels := strings.Split(filter, "/")
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i, level := range levels {
+		switch {
+		case level == "#":
+			if i != len(levels)-1 {
+				return nil, fmt.Errorf("'#' must be the last level")
+			}
+			if i == 0 {
+				expr.WriteString("(.*)")
+			} else {
+				expr.WriteString("(?:/(.*))?")
+			}
+			continue
+		case i > 0:
+			expr.WriteString("/")
+		}
+		switch {
+		case level == "+":
+			expr.WriteString("([^/]*)")
+		case strings.ContainsAny(level, "+#"):
+			return nil, fmt.Errorf("wildcard must occupy an entire level")
+		default:
+			expr.WriteString(regexp.QuoteMeta(level))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// defaultRules replaces from namespace prefix with to namespace
+func defaultRules(from, to string) []*rewriteRule {
+	return []*rewriteRule{{Type: rulePrefix, Match: from, Replace: to}}
+}
+
+// loadRules reads rewrite rules from JSON file, defaults are returned if path is empty
+func loadRules(path string, defaults []*rewriteRule) ([]*rewriteRule, error) {
+	if path == "" {
+		return defaults, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read bridge rules: %v", err)
+	}
+	var rules []*rewriteRule
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("cannot parse bridge rules %s: %v", path, err)
+	}
+	if err = compileRules(rules); err != nil {
+		return nil, fmt.Errorf("bridge rules %s: %v", path, err)
+	}
+	return rules, nil
+}
+
+// compileRules compiles all rules
+func compileRules(rules []*rewriteRule) error {
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteTopic returns topic changed by the first matching rule, false is returned if no rule matches
+func rewriteTopic(rules []*rewriteRule, topic string) (string, bool) {
+	for _, rule := range rules {
+		if newTopic, ok := rule.rewrite(topic); ok {
+			return newTopic, true
+		}
+	}
+	return "", false
+}
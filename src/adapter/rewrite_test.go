@@ -0,0 +1,93 @@
+package adapter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriteTopic(t *testing.T) {
+	rules := []*rewriteRule{
+		{Type: ruleFilter, Match: "dev/+/status/#", Replace: "prod/devices/$1/${2}"},
+		{Type: ruleRegex, Match: `^dev/alerts/(\w+)$`, Replace: "prod/alerts-$1"},
+		{Type: rulePrefix, Match: "dev/", Replace: "prod/"},
+	}
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testCases := []struct {
+		name     string
+		topic    string
+		expected string
+		matched  bool
+	}{
+		{"Test filter", "dev/42/status/battery/level", "prod/devices/42/battery/level", true},
+		{"Test filter without multi-level", "dev/42/status", "prod/devices/42", true},
+		{"Test filter with empty level", "dev/42/status/", "prod/devices/42/", true},
+		{"Test regex", "dev/alerts/fire", "prod/alerts-fire", true},
+		{"Test prefix", "dev/alerts/fire/1", "prod/alerts/fire/1", true},
+		{"Test prefix of whole topic", "dev", "prod", true},
+		{"Test prefix inside level", "devices/x", "", false},
+		{"Test no match", "test/dev/1", "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := rewriteTopic(rules, tc.topic)
+			if got != tc.expected || ok != tc.matched {
+				t.Errorf("unexpected result: %q, %v", got, ok)
+			}
+		})
+	}
+}
+
+func TestRewriteRule_compile(t *testing.T) {
+	testCases := []struct {
+		name string
+		rule rewriteRule
+		fail bool
+	}{
+		{"Test prefix", rewriteRule{Type: rulePrefix, Match: "a"}, false},
+		{"Test filter", rewriteRule{Type: ruleFilter, Match: "+/a/#"}, false},
+		{"Test filter with # in the middle", rewriteRule{Type: ruleFilter, Match: "a/#/b"}, true},
+		{"Test filter with partial wildcard", rewriteRule{Type: ruleFilter, Match: "a/b+"}, true},
+		{"Test bad regex", rewriteRule{Type: ruleRegex, Match: "a("}, true},
+		{"Test unknown type", rewriteRule{Type: "glob", Match: "a"}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.rule.compile(); (err != nil) != tc.fail {
+				t.Errorf("unexpected result: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	conf := defaultRules("dev", "prod")
+	rules, err := loadRules("", conf)
+	if err != nil || len(rules) != 1 || rules[0].Match != "dev" || rules[0].Replace != "prod" {
+		t.Errorf("unexpected default rules: %v, %v", rules, err)
+	}
+
+	dir, err := ioutil.TempDir("", "adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.json")
+	ioutil.WriteFile(path, []byte(`[{"type":"filter","match":"dev/#","replace":"prod/$1"}]`), 0600)
+	if rules, err = loadRules(path, conf); err != nil || len(rules) != 1 || rules[0].re == nil {
+		t.Errorf("unexpected result: %v, %v", rules, err)
+	}
+
+	ioutil.WriteFile(path, []byte(`[{"type":"filter","match":"dev/#/a"}]`), 0600)
+	if _, err = loadRules(path, conf); err == nil {
+		t.Error("Expected not <nil> error for invalid rule")
+	}
+	if _, err = loadRules(filepath.Join(dir, "missing.json"), conf); err == nil {
+		t.Error("Expected not <nil> error for missing file")
+	}
+}
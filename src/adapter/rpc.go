@@ -0,0 +1,182 @@
+package adapter
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/mqtt"
+)
+
+const (
+	// replyToField is a name of envelope field with topic the reply is expected on
+	replyToField = "reply_to"
+	// correlationField is a name of envelope field which matches reply with request
+	correlationField = "correlation_id"
+	// errorField is a name of envelope field with error description
+	errorField = "error"
+
+	defaultRPCTimeout = time.Second * 30
+)
+
+// rpc tracks requests waiting for replies and delivers replies to processor
+type rpc struct {
+	listener mqtt.Subscriber
+	// processor receives replies and timeout errors
+	processor io.Writer
+	timeout   time.Duration
+
+	// subscribed reports topics the adapter is subscribed to for processor input,
+	// replies on them come with the input and rpc neither subscribes to them nor unsubscribes
+	subscribed func(topic string) bool
+
+	// mu also serializes subscriptions to reply topics
+	mu      sync.Mutex
+	pending map[string]*rpcCall
+	// topics counts waiting requests on reply topics subscribed by rpc
+	topics map[string]int
+}
+
+// rpcCall is a request waiting for reply
+type rpcCall struct {
+	topic string
+	timer *time.Timer
+}
+
+// newRPC creates tracker, not positive timeout is replaced by the default one
+func newRPC(listener mqtt.Subscriber, processor io.Writer, timeout time.Duration) *rpc {
+	r := &rpc{
+		listener:   listener,
+		processor:  processor,
+		timeout:    timeout,
+		subscribed: func(string) bool { return false },
+		pending:    map[string]*rpcCall{},
+		topics:     map[string]int{},
+	}
+	if r.timeout <= 0 {
+		r.timeout = defaultRPCTimeout
+	}
+	return r
+}
+
+// track subscribes to reply topic of outbound request, messages without reply_to and correlation_id are skipped
+func (r *rpc) track(msg []byte) {
+	env, err := parseEnvelope(msg)
+	if err != nil {
+		return
+	}
+	topic, ok := env.getString(replyToField)
+	if !ok || topic == "" {
+		return
+	}
+	id, ok := env.getString(correlationField)
+	if !ok || id == "" {
+		logger.Log.Warnf("Request with %s has no %s: %s", replyToField, correlationField, msg)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, found := r.pending[id]; found {
+		logger.Log.Warnf("Request with %s %q is already waiting for reply", correlationField, id)
+		return
+	}
+	r.pending[id] = &rpcCall{topic: topic, timer: time.AfterFunc(r.timeout, func() { r.expire(id) })}
+	if r.subscribed(topic) {
+		return
+	}
+	if r.topics[topic]++; r.topics[topic] == 1 {
+		// MQTT client can't wait for unsubscribe in message handler, so replies are handled in own goroutines
+		r.listener.SubscribeFunc(topic, func(msg mqtt.Received) { go r.reply(msg) })
+	}
+}
+
+// reply delivers message from reply topic to processor if it matches a waiting request
+func (r *rpc) reply(msg mqtt.Received) {
+	env, err := parseEnvelope(msg.Payload)
+	if err != nil {
+		logger.Log.Warnf("Cannot unmarshal reply on %q: %s", msg.Topic, msg.Payload)
+		return
+	}
+	id, _ := env.getString(correlationField)
+	call := r.finish(id)
+	if call == nil {
+		logger.Log.Debugf("Reply on %q doesn't match any request: %s", msg.Topic, msg.Payload)
+		return
+	}
+	call.timer.Stop()
+	r.deliver(msg.Payload)
+}
+
+// expire sends timeout error to processor
+func (r *rpc) expire(id string) {
+	call := r.finish(id)
+	if call == nil {
+		return
+	}
+	env := envelope{}
+	env.set(topicField, call.topic)
+	env.set(correlationField, id)
+	env.set(errorField, fmt.Sprintf("no reply within %s", r.timeout))
+	data, _ := env.bytes()
+	r.deliver(data)
+}
+
+// finish removes waiting request and unsubscribes from its reply topic if no more requests wait on it
+func (r *rpc) finish(id string) *rpcCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	call, found := r.pending[id]
+	if !found {
+		return nil
+	}
+	delete(r.pending, id)
+
+	if _, own := r.topics[call.topic]; !own {
+		return call
+	}
+	if r.topics[call.topic]--; r.topics[call.topic] == 0 {
+		delete(r.topics, call.topic)
+		// the topic may have been subscribed for processor input meanwhile, it replaces rpc subscription
+		if !r.subscribed(call.topic) {
+			r.listener.Unsubscribe(call.topic)
+		}
+	}
+	return call
+}
+
+// passing returns writer of processor input which also ends requests waiting for replies on topics
+// subscribed for the input
+func (r *rpc) passing(processor io.Writer) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		r.settle(p)
+		return processor.Write(p)
+	})
+}
+
+// settle ends request waiting for the reply if the reply comes on topic subscribed for processor input
+func (r *rpc) settle(msg []byte) {
+	env, err := parseEnvelope(msg)
+	if err != nil {
+		return
+	}
+	id, ok := env.getString(correlationField)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	call, found := r.pending[id]
+	r.mu.Unlock()
+	if found && r.subscribed(call.topic) && r.finish(id) != nil {
+		call.timer.Stop()
+	}
+}
+
+// deliver writes message to processor
+func (r *rpc) deliver(msg []byte) {
+	if _, err := r.processor.Write(msg); err != nil {
+		logger.Log.Errorf("Cannot deliver reply to processor: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package adapter
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/mqtt"
+)
+
+// replySubscriber remembers subscriptions to reply topics
+type replySubscriber struct {
+	TestSubscriber
+	mu       sync.Mutex
+	handlers map[string]func(msg mqtt.Received)
+}
+
+func (s *replySubscriber) SubscribeFunc(topic string, handler func(msg mqtt.Received)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[topic] = handler
+}
+
+func (s *replySubscriber) Unsubscribe(topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.handlers, topic)
+}
+
+func (s *replySubscriber) handler(topic string) func(msg mqtt.Received) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handlers[topic]
+}
+
+// processorWriter collects messages delivered to processor
+type processorWriter struct {
+	recordPublisher
+}
+
+func (w *processorWriter) Write(p []byte) (int, error) {
+	return len(p), w.Publish(string(p))
+}
+
+func TestRPC_reply(t *testing.T) {
+	setLog(new(writer))
+	sub := &replySubscriber{handlers: map[string]func(msg mqtt.Received){}}
+	processor := new(processorWriter)
+	r := newRPC(sub, processor, time.Minute)
+
+	r.track([]byte(`{"topic":"svc/a/req","reply_to":"svc/b/replies","correlation_id":"1"}`))
+	r.track([]byte(`{"topic":"svc/a/req","reply_to":"svc/b/replies","correlation_id":"2"}`))
+	r.track([]byte(`{"topic":"svc/a/event"}`))
+	r.track([]byte(`{"topic":"svc/a/req","reply_to":"svc/b/other"}`))
+	handler := sub.handler("svc/b/replies")
+	if handler == nil || len(sub.handlers) != 1 {
+		t.Fatalf("unexpected subscriptions: %v", sub.handlers)
+	}
+
+	r.reply(mqtt.Received{Topic: "svc/b/replies", Payload: []byte(`{"correlation_id":"3"}`)})
+	handler(mqtt.Received{Topic: "svc/b/replies", Payload: []byte(`{"correlation_id":"1","payload":"ok"}`)})
+	msgs := waitMessages(&processor.recordPublisher, 1)
+	if len(msgs) != 1 || msgs[0] != `{"correlation_id":"1","payload":"ok"}` {
+		t.Fatalf("unexpected result: %q", msgs)
+	}
+	// subscription is kept while request 2 is waiting
+	if sub.handler("svc/b/replies") == nil {
+		t.Error("reply topic was unsubscribed too early")
+	}
+	handler(mqtt.Received{Topic: "svc/b/replies", Payload: []byte(`{"correlation_id":"2"}`)})
+	if msgs = waitMessages(&processor.recordPublisher, 2); len(msgs) != 2 {
+		t.Fatalf("unexpected result: %q", msgs)
+	}
+	for i := 0; i < 100 && sub.handler("svc/b/replies") != nil; i++ {
+		<-time.After(time.Millisecond * 10)
+	}
+	if sub.handler("svc/b/replies") != nil {
+		t.Error("reply topic was not unsubscribed")
+	}
+}
+
+func TestRPC_timeout(t *testing.T) {
+	setLog(new(writer))
+	sub := &replySubscriber{handlers: map[string]func(msg mqtt.Received){}}
+	processor := new(processorWriter)
+	r := newRPC(sub, processor, time.Second)
+	r.timeout = time.Millisecond * 10
+
+	r.track([]byte(`{"topic":"svc/a/req","reply_to":"svc/b/replies","correlation_id":"1"}`))
+	msgs := waitMessages(&processor.recordPublisher, 1)
+	if len(msgs) != 1 || !strings.Contains(msgs[0], `"error":"no reply within 10ms"`) ||
+		!strings.Contains(msgs[0], `"correlation_id":"1"`) || !strings.Contains(msgs[0], `"topic":"svc/b/replies"`) {
+		t.Fatalf("unexpected result: %q", msgs)
+	}
+	if sub.handler("svc/b/replies") != nil {
+		t.Error("reply topic was not unsubscribed")
+	}
+}
+
+func TestRPC_subscribedTopic(t *testing.T) {
+	setLog(new(writer))
+	sub := &replySubscriber{handlers: map[string]func(msg mqtt.Received){}}
+	processor := new(processorWriter)
+	r := newRPC(sub, processor, time.Minute)
+	r.subscribed = func(topic string) bool { return topic == "svc/b/replies" }
+	input := r.passing(processor)
+
+	r.track([]byte(`{"topic":"svc/a/req","reply_to":"svc/b/replies","correlation_id":"1"}`))
+	if len(sub.handlers) != 0 {
+		t.Fatalf("input topic is subscribed by rpc: %v", sub.handlers)
+	}
+	input.Write([]byte(`{"correlation_id":"1","payload":"ok"}`))
+	if msgs := processor.messages(); len(msgs) != 1 || len(r.pending) != 0 {
+		t.Fatalf("unexpected result: %q, %v", msgs, r.pending)
+	}
+
+	// input subscription replaces rpc subscription and is kept after the reply
+	r.subscribed = func(string) bool { return false }
+	r.track([]byte(`{"topic":"svc/a/req","reply_to":"svc/b/replies","correlation_id":"2"}`))
+	r.subscribed = func(topic string) bool { return topic == "svc/b/replies" }
+	r.finish("2").timer.Stop()
+	if _, found := sub.handlers["svc/b/replies"]; !found {
+		t.Error("input topic was unsubscribed")
+	}
+}
@@ -0,0 +1,132 @@
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/metrics"
+
+	"github.com/robfig/cron"
+)
+
+const (
+	// scheduleField is a name of trigger envelope field with schedule name
+	scheduleField = "schedule"
+	// firedAtField is a name of trigger envelope field with fire time
+	firedAtField = "fired_at"
+	// payloadField is a name of envelope field with message payload
+	payloadField = "payload"
+
+	firedAtLayout = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// schedule emits trigger envelopes by cron expression or interval as it is set in schedules file.
+// Triggers are written to processor unless topic is set
+type schedule struct {
+	Name    string          `json:"name"`
+	Cron    string          `json:"cron"`
+	Every   string          `json:"every"`
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+
+	spec cron.Schedule
+}
+
+// loadSchedules reads schedules from JSON file
+func loadSchedules(path string) ([]*schedule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read schedules: %v", err)
+	}
+	var schedules []*schedule
+	if err = json.Unmarshal(data, &schedules); err != nil {
+		return nil, fmt.Errorf("cannot parse schedules %s: %v", path, err)
+	}
+	names := map[string]bool{}
+	for i, s := range schedules {
+		if s.Name == "" {
+			return nil, fmt.Errorf("schedules %s: schedule %d has no name", path, i)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("schedules %s: duplicate name %q", path, s.Name)
+		}
+		names[s.Name] = true
+		if err = s.compile(); err != nil {
+			return nil, fmt.Errorf("schedules %s: %s: %v", path, s.Name, err)
+		}
+	}
+	return schedules, nil
+}
+
+// compile parses either cron expression or interval
+func (s *schedule) compile() error {
+	var err error
+	switch {
+	case s.Cron != "" && s.Every != "":
+		return fmt.Errorf("both cron and every are set")
+	case s.Cron != "":
+		s.spec, err = cron.ParseStandard(s.Cron)
+	case s.Every != "":
+		var every time.Duration
+		if every, err = time.ParseDuration(s.Every); err == nil && every < time.Second {
+			err = fmt.Errorf("every %q is less than a second", s.Every)
+		}
+		s.spec = cron.Every(every)
+	default:
+		err = fmt.Errorf("neither cron nor every is set")
+	}
+	return err
+}
+
+// trigger returns trigger envelope fired at the time
+func (s *schedule) trigger(at time.Time) []byte {
+	env := envelope{}
+	if s.Topic != "" {
+		env.set(topicField, fmt.Sprintf("%s/%s", config.Config.NamespacePublisher, s.Topic))
+	}
+	env.set(scheduleField, s.Name)
+	env.set(firedAtField, at.UTC().Format(firedAtLayout))
+	if len(s.Payload) > 0 {
+		env.setRaw(payloadField, s.Payload)
+	}
+	data, _ := env.bytes()
+	return data
+}
+
+// startSchedules starts firing schedules, triggers without topic are written to processor.
+// The returned scheduler must be stopped
+func (c *client) startSchedules(processor io.Writer) *cron.Cron {
+	scheduler := cron.New()
+	for _, s := range c.schedules {
+		s := s
+		scheduler.Schedule(s.spec, cron.FuncJob(func() { c.fire(s, processor, time.Now()) }))
+	}
+	scheduler.Start()
+	return scheduler
+}
+
+// fire emits trigger of the schedule
+func (c *client) fire(s *schedule, processor io.Writer, at time.Time) {
+	msg := s.trigger(at)
+	logger.Log.Debugf("Schedule %s fired: %s", s.Name, msg)
+	metrics.Stats.Add("schedule_"+s.Name+"_fired", 1)
+	var err error
+	if s.Topic != "" {
+		if err = c.checkOutbound(string(msg)); err == nil {
+			err = c.publisher.Publish(string(msg))
+		}
+	} else {
+		_, err = processor.Write(msg)
+	}
+	if err != nil {
+		logger.Log.Warnf("Cannot emit trigger of schedule %s: %v", s.Name, err)
+	}
+}
@@ -0,0 +1,143 @@
+package adapter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/config"
+)
+
+func TestLoadSchedules(t *testing.T) {
+	if s, err := loadSchedules(""); s != nil || err != nil {
+		t.Errorf("unexpected result: %v, %v", s, err)
+	}
+	dir, err := ioutil.TempDir("", "adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "schedules.json")
+
+	testCases := []struct {
+		name string
+		data string
+		fail bool
+	}{
+		{"Test cron", `[{"name":"nightly","cron":"0 3 * * *"}]`, false},
+		{"Test descriptor", `[{"name":"hourly","cron":"@hourly"}]`, false},
+		{"Test every", `[{"name":"tick","every":"3s","topic":"ticks","payload":{"a":1}}]`, false},
+		{"Test no name", `[{"every":"3s"}]`, true},
+		{"Test duplicate name", `[{"name":"tick","every":"3s"},{"name":"tick","every":"5s"}]`, true},
+		{"Test both cron and every", `[{"name":"tick","cron":"* * * * *","every":"3s"}]`, true},
+		{"Test neither cron nor every", `[{"name":"tick"}]`, true},
+		{"Test invalid cron", `[{"name":"tick","cron":"* * *"}]`, true},
+		{"Test invalid every", `[{"name":"tick","every":"often"}]`, true},
+		{"Test too short every", `[{"name":"tick","every":"100ms"}]`, true},
+		{"Test invalid JSON", `{`, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ioutil.WriteFile(path, []byte(tc.data), 0600)
+			s, err := loadSchedules(path)
+			if (err != nil) != tc.fail {
+				t.Fatalf("unexpected result: %v", err)
+			}
+			if !tc.fail && (len(s) != 1 || s[0].spec == nil) {
+				t.Errorf("unexpected result: %v", s)
+			}
+		})
+	}
+	if _, err = loadSchedules(filepath.Join(dir, "absent.json")); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+}
+
+func TestSchedule_trigger(t *testing.T) {
+	config.Config = &config.Configuration{NamespacePublisher: "prod"}
+	at := time.Date(2019, 3, 1, 12, 0, 5, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		schedule *schedule
+		expected string
+	}{
+		{
+			"Test processor trigger",
+			&schedule{Name: "tick"},
+			`{"schedule":"tick","fired_at":"2019-03-01T12:00:05.000Z"}`,
+		},
+		{
+			"Test published trigger with payload",
+			&schedule{Name: "tick", Topic: "ticks", Payload: []byte(`{"a":1}`)},
+			`{"topic":"prod/ticks","schedule":"tick","fired_at":"2019-03-01T12:00:05.000Z","payload":{"a":1}}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := string(tc.schedule.trigger(at)); got != tc.expected {
+				t.Errorf("unexpected result: %s, expected: %s", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestClient_fire(t *testing.T) {
+	setLog(new(writer))
+	config.Config = &config.Configuration{NamespacePublisher: "prod", DeadLetterTopic: "dead"}
+	pub := new(recordPublisher)
+	c := &client{publisher: pub}
+	var processor bytes.Buffer
+	at := time.Now()
+
+	c.fire(&schedule{Name: "tick"}, &processor, at)
+	if processor.Len() == 0 || len(pub.messages()) != 0 {
+		t.Errorf("trigger wasn't written to processor: %q, %v", processor.String(), pub.messages())
+	}
+	processor.Reset()
+	c.fire(&schedule{Name: "tick", Topic: "ticks"}, &processor, at)
+	if processor.Len() != 0 || len(pub.messages()) != 1 {
+		t.Errorf("trigger wasn't published: %q, %v", processor.String(), pub.messages())
+	}
+
+	// published triggers are validated as processor output
+	rule := &schemaRule{Filter: "prod/ticks", Schema: []byte(`{"required":["payload"]}`)}
+	if err := rule.compile(""); err != nil {
+		t.Fatal(err)
+	}
+	c.schemas = validator{rule}
+	c.fire(&schedule{Name: "tick", Topic: "ticks"}, &processor, at)
+	if msgs := pub.messages(); len(msgs) != 2 || !strings.Contains(msgs[1], `"direction":"outbound"`) {
+		t.Errorf("invalid trigger was published: %v", msgs)
+	}
+}
+
+func TestClient_startSchedules(t *testing.T) {
+	setLog(new(writer))
+	config.Config = new(config.Configuration)
+	s := &schedule{Name: "tick", Every: "1s"}
+	if err := s.compile(); err != nil {
+		t.Fatal(err)
+	}
+	fired := make(chan []byte, 1)
+	c := &client{schedules: []*schedule{s}}
+	scheduler := c.startSchedules(writerFunc(func(p []byte) (int, error) {
+		select {
+		case fired <- p:
+		default:
+		}
+		return len(p), nil
+	}))
+	defer scheduler.Stop()
+	select {
+	case msg := <-fired:
+		if env, err := parseEnvelope(msg); err != nil || env == nil {
+			t.Errorf("unexpected trigger: %s", msg)
+		}
+	case <-time.After(time.Second * 3):
+		t.Error("schedule didn't fire")
+	}
+}
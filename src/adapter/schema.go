@@ -0,0 +1,166 @@
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/metrics"
+	"mqtt-adapter/src/mqtt"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const (
+	inbound  = "inbound"
+	outbound = "outbound"
+)
+
+// schemaRule validates messages whose topic matches MQTT topic filter.
+// Schema is either inline JSON Schema or a path to schema file relative to schemas file
+type schemaRule struct {
+	Filter string          `json:"filter"`
+	Schema json.RawMessage `json:"schema"`
+
+	re     *regexp.Regexp
+	schema *gojsonschema.Schema
+}
+
+// validator holds schema rules, the first rule matching message topic is applied
+type validator []*schemaRule
+
+// loadSchemas reads schema rules from JSON file
+func loadSchemas(path string) (validator, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read schemas: %v", err)
+	}
+	var v validator
+	if err = json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("cannot parse schemas %s: %v", path, err)
+	}
+	for i, rule := range v {
+		if err = rule.compile(filepath.Dir(path)); err != nil {
+			return nil, fmt.Errorf("schemas %s: rule %d: %v", path, i, err)
+		}
+	}
+	return v, nil
+}
+
+// compile compiles topic filter and loads schema, relative schema paths are resolved from dir
+func (r *schemaRule) compile(dir string) error {
+	if r.Filter == "" {
+		return fmt.Errorf("filter is not set")
+	}
+	re, err := filterToRegexp(r.Filter)
+	if err != nil {
+		return err
+	}
+	r.re = re
+	if len(r.Schema) == 0 {
+		return fmt.Errorf("schema is not set")
+	}
+	loader := gojsonschema.NewBytesLoader(r.Schema)
+	var path string
+	if json.Unmarshal(r.Schema, &path) == nil {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if path, err = filepath.Abs(path); err != nil {
+			return err
+		}
+		loader = gojsonschema.NewReferenceLoader((&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String())
+	}
+	if r.schema, err = gojsonschema.NewSchema(loader); err != nil {
+		return fmt.Errorf("invalid schema for %q: %v", r.Filter, err)
+	}
+	return nil
+}
+
+// validate returns validation errors of message on the topic, messages without matching rule are not validated
+func (v validator) validate(topic string, msg []byte) []string {
+	for _, rule := range v {
+		if !rule.re.MatchString(topic) {
+			continue
+		}
+		if !json.Valid(msg) {
+			return []string{"message is not JSON"}
+		}
+		result, err := rule.schema.Validate(gojsonschema.NewBytesLoader(msg))
+		if err != nil {
+			return []string{err.Error()}
+		}
+		var errs []string
+		for _, e := range result.Errors() {
+			errs = append(errs, e.String())
+		}
+		return errs
+	}
+	return nil
+}
+
+// checkOutbound validates processor output by envelope topic, rejected envelopes are sent to dead-letter topic.
+// Envelopes without topic are not validated
+func (c *client) checkOutbound(msg string) error {
+	if len(c.schemas) == 0 {
+		return nil
+	}
+	env, err := parseEnvelope([]byte(msg))
+	if err != nil {
+		return nil
+	}
+	topic, ok := env.getString(topicField)
+	if !ok {
+		return nil
+	}
+	if errs := c.schemas.validate(topic, []byte(msg)); len(errs) > 0 {
+		c.deadLetter(outbound, []byte(msg), errs)
+		return fmt.Errorf("envelope doesn't match schema: %v", errs)
+	}
+	return nil
+}
+
+// validatingFunc returns message handler which passes to handler only messages valid by schema of their MQTT topic,
+// rejected messages are sent to dead-letter topic
+func (c *client) validatingFunc(handler func(msg mqtt.Received)) func(msg mqtt.Received) {
+	if len(c.schemas) == 0 {
+		return handler
+	}
+	return func(msg mqtt.Received) {
+		if errs := c.schemas.validate(msg.Topic, msg.Payload); len(errs) > 0 {
+			c.deadLetter(inbound, msg.Payload, errs)
+			return
+		}
+		handler(msg)
+	}
+}
+
+// deadLetter publishes rejected message with validation errors to DEAD_LETTER_TOPIC, it is only logged if the topic is not set
+func (c *client) deadLetter(direction string, msg []byte, errs []string) {
+	metrics.Stats.Add("schema_"+direction+"_rejected", 1)
+	logger.Log.Warnf("Rejected %s message %s: %v", direction, msg, errs)
+	if config.Config.DeadLetterTopic == "" {
+		return
+	}
+	env := envelope{}
+	env.set(topicField, config.Config.DeadLetterTopic)
+	env.set("direction", direction)
+	env.set("errors", errs)
+	if json.Valid(msg) {
+		env.setRaw("message", msg)
+	} else {
+		env.set("message", string(msg))
+	}
+	data, _ := env.bytes()
+	if err := c.publisher.Publish(string(data)); err != nil {
+		logger.Log.Errorf("Cannot publish rejected message to %q: %v", config.Config.DeadLetterTopic, err)
+	}
+}
@@ -0,0 +1,149 @@
+package adapter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/mqtt"
+)
+
+const tickSchema = `{
+	"type": "object",
+	"required": ["topic", "payload"],
+	"properties": {"payload": {"type": "object", "required": ["tick_uuid"]}}
+}`
+
+func testSchemas(t *testing.T) (validator, func()) {
+	dir, err := ioutil.TempDir("", "adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "tick.json"), []byte(tickSchema), 0600)
+	path := filepath.Join(dir, "schemas.json")
+	ioutil.WriteFile(path, []byte(`[
+		{"filter": "dev/ticks/#", "schema": "tick.json"},
+		{"filter": "dev/alerts", "schema": {"required": ["level"]}}
+	]`), 0600)
+	v, err := loadSchemas(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return v, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadSchemas(t *testing.T) {
+	if v, err := loadSchemas(""); v != nil || err != nil {
+		t.Errorf("unexpected result: %v, %v", v, err)
+	}
+	dir, err := ioutil.TempDir("", "adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "schemas.json")
+
+	testCases := []struct {
+		name string
+		data string
+	}{
+		{"Test no filter", `[{"schema": {}}]`},
+		{"Test no schema", `[{"filter": "dev/#"}]`},
+		{"Test invalid filter", `[{"filter": "dev/#/x", "schema": {}}]`},
+		{"Test invalid schema", `[{"filter": "dev/#", "schema": {"type": 1}}]`},
+		{"Test absent schema file", `[{"filter": "dev/#", "schema": "absent.json"}]`},
+		{"Test invalid JSON", `{`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ioutil.WriteFile(path, []byte(tc.data), 0600)
+			if _, err := loadSchemas(path); err == nil {
+				t.Error("Expected not <nil> error")
+			}
+		})
+	}
+	if _, err = loadSchemas(filepath.Join(dir, "absent.json")); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+}
+
+func TestValidator_validate(t *testing.T) {
+	v, cleanup := testSchemas(t)
+	defer cleanup()
+	testCases := []struct {
+		name  string
+		topic string
+		msg   string
+		valid bool
+	}{
+		{"Test valid file schema", "dev/ticks/1", `{"topic":"dev/ticks/1","payload":{"tick_uuid":"x"}}`, true},
+		{"Test invalid file schema", "dev/ticks/1", `{"topic":"dev/ticks/1","payload":{}}`, false},
+		{"Test valid inline schema", "dev/alerts", `{"level":"error"}`, true},
+		{"Test invalid inline schema", "dev/alerts", `{"topic":"dev/alerts"}`, false},
+		{"Test no matching rule", "dev/other", `{"topic":"dev/alerts"}`, true},
+		{"Test not JSON", "dev/alerts", `error`, false},
+		{"Test not JSON without rule", "dev/other", `tick`, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if errs := v.validate(tc.topic, []byte(tc.msg)); (len(errs) == 0) != tc.valid {
+				t.Errorf("unexpected result: %v", errs)
+			}
+		})
+	}
+}
+
+func TestClient_validation(t *testing.T) {
+	setLog(new(writer))
+	v, cleanup := testSchemas(t)
+	defer cleanup()
+	config.Config = &config.Configuration{DeadLetterTopic: "dead/letters"}
+	pub := new(recordPublisher)
+	c := &client{publisher: pub, schemas: v}
+
+	var delivered []string
+	handler := c.validatingFunc(func(msg mqtt.Received) { delivered = append(delivered, string(msg.Payload)) })
+	handler(mqtt.Received{Topic: "dev/alerts", Payload: []byte(`{"code":1}`)})
+	handler(mqtt.Received{Topic: "dev/alerts", Payload: []byte(`alert`)})
+	handler(mqtt.Received{Topic: "dev/alerts", Payload: []byte(`{"level":"error"}`)})
+	handler(mqtt.Received{Topic: "dev/other", Payload: []byte(`other`)})
+	if !reflect.DeepEqual(delivered, []string{`{"level":"error"}`, `other`}) {
+		t.Errorf("unexpected delivered messages: %v", delivered)
+	}
+
+	if err := c.checkOutbound(`{"topic":"dev/ticks/1","payload":{"tick_uuid":"x"}}`); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := c.checkOutbound(`{"topic":"dev/ticks/1"}`); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+
+	msgs := pub.messages()
+	if len(msgs) != 3 {
+		t.Fatalf("unexpected dead letters: %v", msgs)
+	}
+	for i, direction := range []string{inbound, inbound, outbound} {
+		if i == 1 {
+			// not JSON message is passed as string
+			if !strings.Contains(msgs[i], `"message":"alert"`) {
+				t.Errorf("unexpected dead letter: %s", msgs[i])
+			}
+			continue
+		}
+		env, err := parseEnvelope([]byte(msgs[i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		topic, _ := env.getString(topicField)
+		got, _ := env.getString("direction")
+		_, hasErrors := env.get("errors")
+		if topic != "dead/letters" || got != direction || !hasErrors || !strings.Contains(msgs[i], `"message":{`) {
+			t.Errorf("unexpected dead letter: %s", msgs[i])
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/logger"
+)
+
+const (
+	unix = "unix"
+
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = time.Second * 30
+)
+
+var errTransportClosed = errors.New("processor transport is closed")
+
+// socketTransport writes MQTT messages to currently connected processor
+type socketTransport struct {
+	mu        sync.Mutex
+	connected *sync.Cond
+	conn      net.Conn
+	writer    io.Writer
+	closed    bool
+	// done is closed when the transport is closed
+	done chan struct{}
+}
+
+func newSocketTransport() *socketTransport {
+	s := &socketTransport{done: make(chan struct{})}
+	s.connected = sync.NewCond(&s.mu)
+	return s
+}
+
+// Write writes message to processor connection. While processor is not connected, or its connection fails
+// during the write, the message is held until the processor connects. errTransportClosed is returned
+// once the transport is closed
+func (s *socketTransport) Write(p []byte) (n int, err error) {
+	for {
+		conn, writer, err := s.current()
+		if err != nil {
+			return 0, err
+		}
+		// the lock is not held while writing, so a processor which stops reading doesn't block close
+		if n, err = writer.Write(p); err == nil {
+			return n, nil
+		}
+		logger.Log.Warnf("Cannot write to processor: %v. The message is kept until it reconnects", err)
+		s.detach(conn)
+	}
+}
+
+// current waits for processor connection and returns it with its writer
+func (s *socketTransport) current() (net.Conn, io.Writer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.writer == nil && !s.closed {
+		s.connected.Wait()
+	}
+	if s.closed {
+		return nil, nil, errTransportClosed
+	}
+	return s.conn, s.writer, nil
+}
+
+// close closes the current processor connection and rejects new ones, blocked writes return
+func (s *socketTransport) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = nil
+	s.writer = nil
+	s.connected.Broadcast()
+}
+
+func (s *socketTransport) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// attach makes conn the current processor connection and closes previous one
+func (s *socketTransport) attach(conn net.Conn) error {
+	writer, err := newFrameWriter(conn, config.Config.Framing)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errTransportClosed
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = conn
+	s.writer = writer
+	s.connected.Broadcast()
+	return nil
+}
+
+// detach forgets conn if it is still the current processor connection
+func (s *socketTransport) detach(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == conn {
+		s.conn = nil
+		s.writer = nil
+	}
+	conn.Close()
+}
+
+// runSocket launches non-bridge mode with Unix socket processor
+func (c *client) runSocket() {
+	defer c.close()
+
+	transport := newSocketTransport()
+	defer transport.close()
+	path := config.Config.ProcessorSocket
+	var listener net.Listener
+	if !config.Config.SocketDial {
+		if err := removeStaleSocket(path); err != nil {
+			logger.Log.Errorf("Cannot listen on %s: %v", path, err)
+			return
+		}
+		var err error
+		if listener, err = net.Listen(unix, path); err != nil {
+			logger.Log.Errorf("Cannot listen on %s: %v", path, err)
+			return
+		}
+		defer listener.Close()
+	}
+	q, err := c.newInboundQueue(func() {
+		transport.close()
+		if listener != nil {
+			listener.Close()
+		}
+	})
+	if err != nil {
+		logger.Log.Error(err)
+		return
+	}
+	defer q.close()
+	go q.drain(transport)
+
+	c.rpc = newRPC(c.listener, q, config.Config.RPCTimeout)
+	processor := c.rpc.passing(q)
+	subs := c.newSubscriptions(func(topic string) { c.subscribe(processor, topic) })
+	c.rpc.subscribed = subs.has
+	c.control = &control{acl: c.acl, subs: subs, processor: q}
+	c.listen(subs)
+	defer c.watchSubscriptions(subs)()
+	defer c.startSchedules(q).Stop()
+
+	if listener == nil {
+		c.dialSocket(path, transport)
+		return
+	}
+	logger.Log.Infof("Waiting for processor on %s", path)
+	c.serveSocket(listener, transport)
+}
+
+// removeStaleSocket removes socket file left by previous run. Other files and sockets somebody listens on
+// are not removed
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial(unix, path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	return os.Remove(path)
+}
+
+// serveSocket accepts processor connections until listener is closed.
+// A new connection replaces the previous one
+func (c *client) serveSocket(listener net.Listener, transport *socketTransport) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			logger.Log.Warnf("Processor socket closed: %v", err)
+			return
+		}
+		logger.Log.Infoln("Processor connected")
+		if err = transport.attach(conn); err != nil {
+			logger.Log.Error(err)
+			conn.Close()
+			continue
+		}
+		go c.readSocket(conn, transport)
+	}
+}
+
+// dialSocket connects to processor socket and reconnects when the connection is lost.
+// It returns once transport is closed
+func (c *client) dialSocket(path string, transport *socketTransport) {
+	backoff := reconnectMinBackoff
+	for !transport.isClosed() {
+		conn, err := net.Dial(unix, path)
+		if err != nil {
+			logger.Log.Warnf("Cannot connect to processor on %s: %v. Retry in %s", path, err, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-transport.done:
+				return
+			}
+			if backoff *= 2; backoff > reconnectMaxBackoff {
+				backoff = reconnectMaxBackoff
+			}
+			continue
+		}
+		backoff = reconnectMinBackoff
+		logger.Log.Infof("Connected to processor on %s", path)
+		if err = transport.attach(conn); err != nil {
+			logger.Log.Error(err)
+			conn.Close()
+			return
+		}
+		c.readSocket(conn, transport)
+	}
+}
+
+// sleepBackoff waits for backoff and returns the doubled one
+func sleepBackoff(backoff time.Duration) time.Duration {
+	time.Sleep(backoff)
+	if backoff *= 2; backoff > reconnectMaxBackoff {
+		return reconnectMaxBackoff
+	}
+	return backoff
+}
+
+// readSocket publishes messages from processor connection until it is closed
+func (c *client) readSocket(conn net.Conn, transport *socketTransport) {
+	defer transport.detach(conn)
+	scanner, err := newFrameScanner(conn, config.Config.Framing, config.Config.MaxMessageSize)
+	if err != nil {
+		logger.Log.Error(err)
+		return
+	}
+	for scanner.Scan() {
+		c.publish(scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		logger.Log.Warnf("Reading processor socket failed: %v", err)
+	}
+	logger.Log.Infoln("Processor disconnected")
+}
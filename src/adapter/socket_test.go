@@ -0,0 +1,188 @@
+package adapter
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func socketPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "processor.sock"), func() { os.RemoveAll(dir) }
+}
+
+func waitMessages(pub *recordPublisher, count int) []string {
+	for i := 0; i < 100 && len(pub.messages()) < count; i++ {
+		<-time.After(time.Millisecond * 10)
+	}
+	return pub.messages()
+}
+
+func TestClient_serveSocket(t *testing.T) {
+	setLog(new(writer))
+	loadConf()
+	path, cleanup := socketPath(t)
+	defer cleanup()
+
+	listener, err := net.Listen(unix, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	pub := new(recordPublisher)
+	cl := &client{listener: TestSubscriber{}, publisher: pub}
+	transport := newSocketTransport()
+	defer transport.close()
+	served := make(chan struct{})
+	go func() {
+		cl.serveSocket(listener, transport)
+		close(served)
+	}()
+	// the server is waited for, so it doesn't log after the test
+	defer func() {
+		listener.Close()
+		<-served
+	}()
+
+	// the message written without connected processor is held until it connects
+	written := make(chan error, 1)
+	go func() {
+		_, err := transport.Write([]byte(`{"topic":"held"}`))
+		written <- err
+	}()
+
+	// processor connects, reconnects and keeps exchanging messages
+	for i, msg := range []string{`{"topic":"first"}`, `{"topic":"second"}`} {
+		conn, err := net.Dial(unix, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(conn)
+		if i == 0 {
+			line, err := reader.ReadString('\n')
+			if err != nil || line != "{\"topic\":\"held\"}\n" || <-written != nil {
+				t.Errorf("unexpected result: %q, %v", line, err)
+			}
+		}
+		conn.Write([]byte(msg + "\n"))
+		if got := waitMessages(pub, i+1); len(got) != i+1 || got[i] != msg {
+			t.Fatalf("unexpected result: %q", got)
+		}
+		if _, err = transport.Write([]byte(`{"topic":"in"}`)); err != nil {
+			t.Fatal(err)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil || line != "{\"topic\":\"in\"}\n" {
+			t.Errorf("unexpected result: %q, %v", line, err)
+		}
+		conn.Close()
+		// reader of the connection has finished when it is detached
+		for j := 0; ; j++ {
+			transport.mu.Lock()
+			current := transport.conn
+			transport.mu.Unlock()
+			if current == nil {
+				break
+			}
+			if j == 100 {
+				t.Fatal("connection is not detached")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// closed transport releases blocked writes
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		transport.close()
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err = transport.Write([]byte(`{"topic":"in"}`)); err == errTransportClosed {
+			return
+		}
+	}
+	t.Errorf("unexpected result: %v", err)
+}
+
+func TestClient_dialSocket(t *testing.T) {
+	setLog(new(writer))
+	loadConf()
+	path, cleanup := socketPath(t)
+	defer cleanup()
+
+	listener, err := net.Listen(unix, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	pub := new(recordPublisher)
+	cl := &client{listener: TestSubscriber{}, publisher: pub}
+	transport := newSocketTransport()
+	stopped := make(chan struct{})
+	go func() {
+		cl.dialSocket(path, transport)
+		close(stopped)
+	}()
+	defer func() {
+		transport.close()
+		<-stopped
+	}()
+
+	for i := 0; i < 2; i++ {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte(`{"topic":"test"}` + "\n"))
+		if got := waitMessages(pub, i+1); len(got) != i+1 {
+			t.Fatalf("unexpected result: %q", got)
+		}
+		conn.Close()
+	}
+	// the last connection is closed by transport when the test ends
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte(`{"topic":"test"}` + "\n"))
+	waitMessages(pub, 3)
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	path, cleanup := socketPath(t)
+	defer cleanup()
+	if err := removeStaleSocket(path); err != nil {
+		t.Error(err)
+	}
+
+	listener, err := net.Listen(unix, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = removeStaleSocket(path); err == nil {
+		t.Error("Expected not <nil> error for socket in use")
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	if err = removeStaleSocket(path); err != nil {
+		t.Error(err)
+	}
+	if _, err = os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("stale socket is not removed: %v", err)
+	}
+
+	ioutil.WriteFile(path, []byte("data"), 0600)
+	if err = removeStaleSocket(path); err == nil {
+		t.Error("Expected not <nil> error for regular file")
+	}
+	if _, err = os.Lstat(path); err != nil {
+		t.Errorf("regular file is removed: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package adapter
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/mqtt"
+)
+
+// subscriptions is a set of topic filters the listener is subscribed to in non-bridge mode.
+// Filters are relative to listener namespace
+type subscriptions struct {
+	mu        sync.Mutex
+	namespace string
+	subscribe func(topic string)
+	listener  mqtt.Subscriber
+	filters   map[string]bool
+	// dynamic are filters subscribed by processor control envelopes
+	dynamic map[string]bool
+}
+
+// newSubscriptions creates empty subscriptions set, subscribe function subscribes to topic in listener namespace
+func (c *client) newSubscriptions(subscribe func(topic string)) *subscriptions {
+	return &subscriptions{
+		namespace: config.Config.NamespaceListener,
+		subscribe: subscribe,
+		listener:  c.listener,
+		filters:   map[string]bool{},
+		dynamic:   map[string]bool{},
+	}
+}
+
+// listen subscribes to filters of the client topic
+func (c *client) listen(s *subscriptions) {
+	if c.topic == "" {
+		logger.Log.Error("Cannot start Listener: topic is not initialized")
+		return
+	}
+	go s.update(splitFilters(c.topic))
+}
+
+// splitFilters returns not empty unique filters of subscriptions, one filter per line
+func splitFilters(topic string) []string {
+	var filters []string
+	found := map[string]bool{}
+	for _, line := range strings.Split(topic, "\n") {
+		filter := strings.TrimSpace(line)
+		if filter == "" || found[filter] {
+			continue
+		}
+		found[filter] = true
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
+// update subscribes to new filters and unsubscribes from filters which are not in the set anymore.
+// Filters subscribed by processor stay subscribed
+func (s *subscriptions) update(filters []string) (added, removed []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := map[string]bool{}
+	for _, filter := range filters {
+		next[filter] = true
+		if !s.filters[filter] {
+			added = append(added, filter)
+		}
+	}
+	for filter := range s.filters {
+		if !next[filter] {
+			removed = append(removed, filter)
+		}
+	}
+	sort.Strings(removed)
+	for _, filter := range removed {
+		if !s.dynamic[filter] {
+			s.listener.Unsubscribe(s.topic(filter))
+		}
+	}
+	for _, filter := range added {
+		if !s.dynamic[filter] {
+			s.subscribe(s.topic(filter))
+		}
+	}
+	s.filters = next
+	return added, removed
+}
+
+// add subscribes to filter requested by processor
+func (s *subscriptions) add(filter string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dynamic[filter] {
+		return
+	}
+	s.dynamic[filter] = true
+	if !s.filters[filter] {
+		s.subscribe(s.topic(filter))
+	}
+}
+
+// remove unsubscribes from filter requested by processor, filters of subscriptions file can't be removed
+func (s *subscriptions) remove(filter string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.filters[filter] {
+		return fmt.Errorf("%q is subscribed by subscriptions file", filter)
+	}
+	if !s.dynamic[filter] {
+		return fmt.Errorf("%q is not subscribed", filter)
+	}
+	delete(s.dynamic, filter)
+	s.listener.Unsubscribe(s.topic(filter))
+	return nil
+}
+
+// has reports whether the topic is subscribed by a filter of the set
+func (s *subscriptions) has(topic string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for filter := range s.filters {
+		if s.topic(filter) == topic {
+			return true
+		}
+	}
+	for filter := range s.dynamic {
+		if s.topic(filter) == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// topic returns topic of the filter in listener namespace
+func (s *subscriptions) topic(filter string) string {
+	return fmt.Sprintf("%s/%s", s.namespace, filter)
+}
+
+// reload reads subscriptions file and applies changed filters.
+// The current filters are kept if the file cannot be read or is empty
+func (s *subscriptions) reload(path string) {
+	topic, err := config.ReadSubscriptions(path)
+	if err != nil {
+		logger.Log.Warnf("Cannot reload subscriptions: %v", err)
+		return
+	}
+	filters := splitFilters(topic)
+	if len(filters) == 0 {
+		logger.Log.Warnf("Subscriptions file %s is empty, subscriptions are not changed", path)
+		return
+	}
+	if added, removed := s.update(filters); len(added) > 0 || len(removed) > 0 {
+		logger.Log.Infof("Subscriptions reloaded from %s: subscribed %v, unsubscribed %v", path, added, removed)
+	}
+}
+
+// watchSubscriptions reloads subscriptions file on SIGHUP and every SUBSCRIPTIONS_RELOAD,
+// it returns function which stops watching and waits for a reload in progress
+func (c *client) watchSubscriptions(s *subscriptions) func() {
+	path := config.Config.SubscriptionsFile()
+	if path == "" {
+		return func() {}
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	var tick <-chan time.Time
+	stopTicker := func() {}
+	if config.Config.SubsReload > 0 {
+		ticker := time.NewTicker(config.Config.SubsReload)
+		tick, stopTicker = ticker.C, ticker.Stop
+	}
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-hangup:
+				logger.Log.Infof("SIGHUP received, reloading subscriptions from %s", path)
+				s.reload(path)
+			case <-tick:
+				s.reload(path)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hangup)
+		stopTicker()
+		close(done)
+		<-exited
+	}
+}
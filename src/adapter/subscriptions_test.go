@@ -0,0 +1,136 @@
+package adapter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/config"
+)
+
+func TestSplitFilters(t *testing.T) {
+	testCases := []struct {
+		name     string
+		topic    string
+		expected []string
+	}{
+		{"Test empty", "", nil},
+		{"Test one filter", "dev/#", []string{"dev/#"}},
+		{"Test lines", " dev/# \n\n sensors/+/temp\r\ndev/#\n", []string{"dev/#", "sensors/+/temp"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := splitFilters(tc.topic); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("unexpected result: %q", got)
+			}
+		})
+	}
+}
+
+func TestSubscriptions_update(t *testing.T) {
+	sub := new(recordSubscriber)
+	var subscribed []string
+	s := &subscriptions{
+		namespace: "prod",
+		subscribe: func(topic string) { subscribed = append(subscribed, topic) },
+		listener:  sub,
+		filters:   map[string]bool{},
+	}
+	added, removed := s.update([]string{"a/#", "b/#"})
+	if !reflect.DeepEqual(added, []string{"a/#", "b/#"}) || removed != nil {
+		t.Errorf("unexpected result: %v, %v", added, removed)
+	}
+	added, removed = s.update([]string{"b/#", "c/#"})
+	if !reflect.DeepEqual(added, []string{"c/#"}) || !reflect.DeepEqual(removed, []string{"a/#"}) {
+		t.Errorf("unexpected result: %v, %v", added, removed)
+	}
+	if added, removed = s.update([]string{"c/#", "b/#"}); added != nil || removed != nil {
+		t.Errorf("unexpected result: %v, %v", added, removed)
+	}
+	_, unsubscribed := sub.topics()
+	if !reflect.DeepEqual(subscribed, []string{"prod/a/#", "prod/b/#", "prod/c/#"}) ||
+		!reflect.DeepEqual(unsubscribed, []string{"prod/a/#"}) {
+		t.Errorf("unexpected topics: %v, %v", subscribed, unsubscribed)
+	}
+
+	// filter subscribed by processor stays subscribed when it is removed from file
+	s.dynamic = map[string]bool{"c/#": true}
+	s.update([]string{"b/#"})
+	if _, unsubscribed = sub.topics(); len(unsubscribed) != 1 {
+		t.Errorf("unexpected topics: %v", unsubscribed)
+	}
+}
+
+func TestClient_watchSubscriptions(t *testing.T) {
+	setLog(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "subscriptions.txt")
+	ioutil.WriteFile(path, []byte("a/#\nb/#"), 0600)
+
+	config.Config = &config.Configuration{NamespaceListener: "prod", SubscriptionsPath: path, Topic: "a/#\nb/#"}
+	sub := new(recordSubscriber)
+	c := &client{topic: config.Config.Topic, listener: sub}
+	s := c.newSubscriptions(func(topic string) { sub.Subscribe(topic, nil) })
+	c.listen(s)
+	stop := c.watchSubscriptions(s)
+	defer stop()
+	wait := func(subscribed, unsubscribed int) {
+		for i := 0; i < 100; i++ {
+			if subs, unsubs := sub.topics(); len(subs) == subscribed && len(unsubs) == unsubscribed {
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		subs, unsubs := sub.topics()
+		t.Fatalf("unexpected topics: %v, %v", subs, unsubs)
+	}
+	wait(2, 0)
+
+	// empty file keeps subscriptions
+	ioutil.WriteFile(path, nil, 0600)
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	time.Sleep(time.Millisecond * 50)
+	wait(2, 0)
+
+	ioutil.WriteFile(path, []byte("b/#\nc/#"), 0600)
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	wait(3, 1)
+	subs, unsubs := sub.topics()
+	if subs[2] != "prod/c/#" || unsubs[0] != "prod/a/#" {
+		t.Errorf("unexpected topics: %v, %v", subs, unsubs)
+	}
+}
+
+func TestClient_watchSubscriptionsStop(t *testing.T) {
+	setLog(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "subscriptions.txt")
+	ioutil.WriteFile(path, []byte("a/#"), 0600)
+
+	config.Config = &config.Configuration{NamespaceListener: "prod", SubscriptionsPath: path, Topic: "a/#",
+		SubsReload: time.Millisecond * 5}
+	sub := new(recordSubscriber)
+	c := &client{topic: config.Config.Topic, listener: sub}
+	s := c.newSubscriptions(func(topic string) { sub.Subscribe(topic, nil) })
+	c.listen(s)
+	c.watchSubscriptions(s)()
+
+	// no reload happens after stop returns
+	ioutil.WriteFile(path, []byte("b/#"), 0600)
+	time.Sleep(time.Millisecond * 50)
+	if subs, unsubs := sub.topics(); len(subs) != 1 || len(unsubs) != 0 {
+		t.Errorf("unexpected topics: %v, %v", subs, unsubs)
+	}
+}
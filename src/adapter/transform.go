@@ -0,0 +1,234 @@
+package adapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/metrics"
+)
+
+const (
+	// transformSet sets value to the field, string values may contain ${now}, ${host} and ${origin}
+	transformSet = "set"
+	// transformRemove removes the field
+	transformRemove = "remove"
+	// transformMove renames field from to the field path
+	transformMove = "move"
+	// transformCopy copies field from to the field path
+	transformCopy = "copy"
+)
+
+// transformStep is a step of transform pipeline as it is set in transforms file
+type transformStep struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+
+	value   interface{}
+	counter string
+}
+
+// pipeline is an ordered list of transform steps
+type pipeline []*transformStep
+
+// loadTransforms reads transform pipeline from JSON file, name is a prefix of step error counters
+func loadTransforms(path, name string) (pipeline, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read bridge transforms: %v", err)
+	}
+	var p pipeline
+	if err = json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("cannot parse bridge transforms %s: %v", path, err)
+	}
+	if err = p.compile(name); err != nil {
+		return nil, fmt.Errorf("bridge transforms %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// compile compiles all steps, name is a prefix of step error counters
+func (p pipeline) compile(name string) error {
+	for i, step := range p {
+		if err := step.compile(); err != nil {
+			return fmt.Errorf("step %d: %v", i, err)
+		}
+		step.counter = fmt.Sprintf("%s_transform_%d_%s_errors", name, i, step.Op)
+	}
+	return nil
+}
+
+// compile checks the step and decodes its value
+func (s *transformStep) compile() error {
+	if s.Path == "" {
+		return fmt.Errorf("path of %q step is not set", s.Op)
+	}
+	switch s.Op {
+	case transformSet:
+		if err := decodeJSON(s.Value, &s.value); err != nil {
+			return fmt.Errorf("invalid value of %q step: %v", s.Op, err)
+		}
+	case transformRemove:
+	case transformMove, transformCopy:
+		if s.From == "" {
+			return fmt.Errorf("from of %q step is not set", s.Op)
+		}
+	default:
+		return fmt.Errorf("unknown transform %q", s.Op)
+	}
+	return nil
+}
+
+// apply runs steps on the message, failed steps are skipped and counted
+func (p pipeline) apply(msg []byte) ([]byte, error) {
+	if len(p) == 0 {
+		return msg, nil
+	}
+	var doc interface{}
+	if err := decodeJSON(msg, &doc); err != nil {
+		metrics.Stats.Add("transform_decode_errors", 1)
+		return nil, err
+	}
+	vars := strings.NewReplacer(
+		"${now}", time.Now().UTC().Format(time.RFC3339),
+		"${host}", config.Config.Host,
+		"${origin}", config.Config.BridgeOrigin,
+	)
+	for _, step := range p {
+		if err := step.apply(doc, vars); err != nil {
+			metrics.Stats.Add(step.counter, 1)
+			logger.Log.Warnf("Transform %q of %q failed: %v", step.Op, step.Path, err)
+		}
+	}
+	obj, isObject := doc.(map[string]interface{})
+	if !isObject {
+		return marshal(doc)
+	}
+	env, err := parseEnvelope(msg)
+	if err != nil {
+		return nil, err
+	}
+	return p.encode(env, obj)
+}
+
+// encode writes transformed fields to the original envelope, so fields keep their order and fields not changed
+// by steps keep their encoding. New fields are added to the end in the order of steps
+func (p pipeline) encode(env *envelope, doc map[string]interface{}) ([]byte, error) {
+	for _, field := range append([]string(nil), env.keys...) {
+		if _, ok := doc[field]; !ok {
+			env.remove(field)
+		}
+	}
+	for _, step := range p {
+		field := strings.SplitN(strings.TrimPrefix(step.Path, "$."), ".", 2)[0]
+		if value, ok := doc[field]; ok {
+			if err := env.set(field, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return env.bytes()
+}
+
+// apply runs the step on decoded message
+func (s *transformStep) apply(doc interface{}, vars *strings.Replacer) error {
+	switch s.Op {
+	case transformSet:
+		value := s.value
+		if str, ok := value.(string); ok {
+			value = vars.Replace(str)
+		}
+		return setPath(doc, s.Path, value)
+	case transformRemove:
+		parent, field, err := parentOf(doc, s.Path, false)
+		if err != nil || parent == nil {
+			return err
+		}
+		delete(parent, field)
+		return nil
+	}
+	parent, field, err := parentOf(doc, s.From, false)
+	if err != nil {
+		return err
+	}
+	value, ok := parent[field]
+	if parent == nil || !ok {
+		return fmt.Errorf("field %q not found", s.From)
+	}
+	if s.Op == transformMove {
+		delete(parent, field)
+	} else {
+		value = copyValue(value)
+	}
+	return setPath(doc, s.Path, value)
+}
+
+// copyValue returns deep copy of decoded JSON value, so a copy doesn't share objects and arrays with the source
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for field, item := range v {
+			obj[field] = copyValue(item)
+		}
+		return obj
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = copyValue(item)
+		}
+		return list
+	}
+	return value
+}
+
+// setPath sets value of the field, missing objects on the path are created
+func setPath(doc interface{}, path string, value interface{}) error {
+	parent, field, err := parentOf(doc, path, true)
+	if err != nil {
+		return err
+	}
+	parent[field] = value
+	return nil
+}
+
+// parentOf returns object which contains the last field of dotted path.
+// nil is returned if create is false and an object on the path is missing
+func parentOf(doc interface{}, path string, create bool) (map[string]interface{}, string, error) {
+	fields := strings.Split(strings.TrimPrefix(path, "$."), ".")
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("message is not a JSON object")
+	}
+	for _, field := range fields[:len(fields)-1] {
+		next, found := obj[field]
+		if !found {
+			if !create {
+				return nil, "", nil
+			}
+			next = map[string]interface{}{}
+			obj[field] = next
+		}
+		if obj, ok = next.(map[string]interface{}); !ok {
+			return nil, "", fmt.Errorf("field %q is not a JSON object", field)
+		}
+	}
+	return obj, fields[len(fields)-1], nil
+}
+
+// decodeJSON decodes data keeping numbers as is
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,106 @@
+package adapter
+
+import (
+	"expvar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/metrics"
+)
+
+func TestPipeline_apply(t *testing.T) {
+	setLog(new(writer))
+	config.Config = &config.Configuration{Host: "plant-1", BridgeOrigin: "edge"}
+	dir, err := ioutil.TempDir("", "adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "transforms.json")
+	ioutil.WriteFile(path, []byte(`[
+		{"op":"remove","path":"payload.internal"},
+		{"op":"move","from":"payload.temp","path":"payload.temperature"},
+		{"op":"copy","from":"topic","path":"meta.source_topic"},
+		{"op":"set","path":"bridge_host","value":"${host}/${origin}"},
+		{"op":"set","path":"version","value":2},
+		{"op":"move","from":"payload.missing","path":"payload.found"},
+		{"op":"set","path":"topic.level","value":1}
+	]`), 0600)
+	p, err := loadTransforms(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := p.apply([]byte(`{"topic":"a/b","payload":{"internal":true,"temp":21.50,"big":12345678901234567890}}`))
+	expected := `{"topic":"a/b","payload":{"big":12345678901234567890,"temperature":21.50},` +
+		`"meta":{"source_topic":"a/b"},"bridge_host":"plant-1/edge","version":2}`
+	if err != nil || string(out) != expected {
+		t.Errorf("unexpected result: %s, %v", out, err)
+	}
+	// failed steps are counted separately
+	for _, counter := range []string{"test_transform_5_move_errors", "test_transform_6_set_errors"} {
+		if v, ok := metrics.Stats.Get(counter).(*expvar.Int); !ok || v.Value() != 1 {
+			t.Errorf("unexpected counter %s: %v", counter, metrics.Stats.Get(counter))
+		}
+	}
+
+	if _, err = p.apply([]byte("not JSON")); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+	if out, err = pipeline(nil).apply([]byte("not JSON")); err != nil || string(out) != "not JSON" {
+		t.Errorf("unexpected result: %s, %v", out, err)
+	}
+}
+
+func TestPipeline_applyCopyAndOrder(t *testing.T) {
+	setLog(new(writer))
+	config.Config = new(config.Configuration)
+	p := pipeline{
+		{Op: transformCopy, From: "payload", Path: "original"},
+		{Op: transformSet, Path: "payload.v", Value: []byte(`2`)},
+		{Op: transformRemove, Path: "internal"},
+	}
+	if err := p.compile("test"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := p.apply([]byte(`{"topic":"a/<b>","internal":1,"payload":{"v":1,"list":[1]},"meta":{"z":1,"a":2}}`))
+	expected := `{"topic":"a/<b>","payload":{"list":[1],"v":2},"meta":{"z":1,"a":2},"original":{"list":[1],"v":1}}`
+	if err != nil || string(out) != expected {
+		t.Errorf("unexpected result: %s, %v", out, err)
+	}
+}
+
+func TestPipeline_setNow(t *testing.T) {
+	config.Config = new(config.Configuration)
+	step := &transformStep{Op: transformSet, Path: "bridged_at", Value: []byte(`"${now}"`)}
+	if err := step.compile(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := pipeline{step}.apply([]byte(`{}`))
+	if err != nil || !strings.HasPrefix(string(out), `{"bridged_at":"20`) {
+		t.Errorf("unexpected result: %s, %v", out, err)
+	}
+}
+
+func TestTransformStep_compile(t *testing.T) {
+	testCases := []struct {
+		name string
+		step transformStep
+	}{
+		{"Test without path", transformStep{Op: transformRemove}},
+		{"Test unknown op", transformStep{Op: "patch", Path: "a"}},
+		{"Test set without value", transformStep{Op: transformSet, Path: "a"}},
+		{"Test move without from", transformStep{Op: transformMove, Path: "a"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.step.compile(); err == nil {
+				t.Error("Expected not <nil> error")
+			}
+		})
+	}
+}
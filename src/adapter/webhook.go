@@ -0,0 +1,185 @@
+package adapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/logger"
+)
+
+const (
+	// publishPath is a path of inbound HTTP endpoint for publishing messages
+	publishPath = "/publish"
+
+	webhookTimeout = time.Second * 10
+)
+
+var errTooLarge = errors.New("body exceeds MAX_MESSAGE_SIZE")
+
+// webhook posts every message written to it to the processor URL
+// and publishes envelopes from the response body
+type webhook struct {
+	url     string
+	client  *http.Client
+	c       *client
+	maxSize int
+}
+
+// runWebhook launches non-bridge mode with HTTP processor
+func (c *client) runWebhook() {
+	defer c.close()
+
+	hook := &webhook{
+		url:     config.Config.WebhookURL,
+		client:  &http.Client{Timeout: webhookTimeout},
+		c:       c,
+		maxSize: config.Config.MaxMessageSize,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(publishPath, c.publishHandler(config.Config.MaxMessageSize))
+	srv := &http.Server{Addr: config.Config.HTTPListen, Handler: mux}
+	// webhook requests are posted from the queue, so MQTT callbacks don't wait for the processor
+	q, err := c.newInboundQueue(func() { srv.Close() })
+	if err != nil {
+		logger.Log.Error(err)
+		return
+	}
+	defer q.close()
+	go q.drain(hook)
+
+	c.rpc = newRPC(c.listener, q, config.Config.RPCTimeout)
+	processor := c.rpc.passing(q)
+	subs := c.newSubscriptions(func(topic string) { c.subscribe(processor, topic) })
+	c.rpc.subscribed = subs.has
+	c.control = &control{acl: c.acl, subs: subs, processor: q}
+	c.listen(subs)
+	defer c.watchSubscriptions(subs)()
+	defer c.startSchedules(q).Stop()
+
+	logger.Log.Infof("Processor webhook: %s, listening for publish requests on %s%s",
+		config.Config.WebhookURL, config.Config.HTTPListen, publishPath)
+	err = srv.ListenAndServe()
+	logger.Log.Errorf("HTTP server stopped: %v", err)
+}
+
+// Write posts MQTT message to processor webhook
+func (h *webhook) Write(p []byte) (n int, err error) {
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(p))
+	if err != nil {
+		logger.Log.Errorf("Processor webhook request failed: %v", err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := readLimited(resp.Body, h.maxSize)
+	if err == errTooLarge {
+		logger.Log.Warnf("Processor webhook response %s", err)
+		return len(p), nil
+	}
+	if err != nil {
+		logger.Log.Errorf("Reading processor webhook response failed: %v", err)
+		return 0, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		logger.Log.Warnf("Processor webhook responded with %s: %s", resp.Status, body)
+		return len(p), nil
+	}
+	messages, err := splitEnvelopes(body)
+	if err != nil {
+		logger.Log.Warnf("Cannot read envelopes from processor webhook response: %v", err)
+		return len(p), nil
+	}
+	for _, msg := range messages {
+		h.c.publish(msg)
+	}
+	return len(p), nil
+}
+
+// publishHandler returns handler which publishes envelopes posted by the processor,
+// bodies bigger than maxSize are rejected
+func (c *client) publishHandler(maxSize int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := readLimited(http.MaxBytesReader(w, r.Body, int64(limitOf(maxSize))+1), maxSize)
+		if err == errTooLarge {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		messages, err := splitEnvelopes(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var failed []string
+		for _, msg := range messages {
+			if err := c.publish(msg); err != nil {
+				failed = append(failed, err.Error())
+			}
+		}
+		if len(failed) > 0 {
+			http.Error(w, strings.Join(failed, "\n"), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// limitOf returns maxSize or the default size if it is not set
+func limitOf(maxSize int) int {
+	if maxSize <= 0 {
+		return defaultMaxMessageSize
+	}
+	return maxSize
+}
+
+// readLimited reads r, it returns errTooLarge if r has more than maxSize bytes
+func readLimited(r io.Reader, maxSize int) ([]byte, error) {
+	limit := limitOf(maxSize)
+	body, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > limit {
+		return nil, errTooLarge
+	}
+	return body, nil
+}
+
+// splitEnvelopes returns envelopes from JSON array or new line delimited body
+func splitEnvelopes(body []byte) ([]string, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var messages []string
+	if body[0] == '[' {
+		var raw []json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, err
+		}
+		for _, msg := range raw {
+			messages = append(messages, string(msg))
+		}
+		return messages, nil
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			messages = append(messages, line)
+		}
+	}
+	return messages, nil
+}
@@ -0,0 +1,106 @@
+package adapter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/mqtt"
+)
+
+func TestWebhook_Write(t *testing.T) {
+	wr := new(writer)
+	setLog(wr)
+	testCases := []struct {
+		name     string
+		status   int
+		response string
+		want     []string
+	}{
+		{"Test with one envelope", http.StatusOK, `{"topic":"a"}`, []string{`{"topic":"a"}`}},
+		{"Test with envelopes array", http.StatusOK, `[{"topic":"a"},{"topic":"b"}]`, []string{`{"topic":"a"}`, `{"topic":"b"}`}},
+		{"Test with new line delimited envelopes", http.StatusOK, "{\"topic\":\"a\"}\n\n{\"topic\":\"b\"}\n", []string{`{"topic":"a"}`, `{"topic":"b"}`}},
+		{"Test with empty response", http.StatusNoContent, "", nil},
+		{"Test with error response", http.StatusInternalServerError, `{"topic":"a"}`, nil},
+		{"Test with too large response", http.StatusOK, `[{"topic":"a"},{"topic":"b"},{"topic":"c"}]`, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received string
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				received = string(body)
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.response))
+			}))
+			defer svr.Close()
+
+			pub := new(recordPublisher)
+			hook := &webhook{url: svr.URL, client: svr.Client(), c: &client{publisher: pub}, maxSize: 32}
+			if _, err := hook.Write([]byte(`{"topic":"in"}`)); err != nil {
+				t.Fatal(err)
+			}
+			if received != `{"topic":"in"}` {
+				t.Errorf("unexpected request body: %q", received)
+			}
+			if strings.Join(pub.messages(), "|") != strings.Join(tc.want, "|") {
+				t.Errorf("unexpected result: %q", pub.messages())
+			}
+		})
+	}
+}
+
+func TestWebhook_WriteWithUnreachableProcessor(t *testing.T) {
+	setLog(new(writer))
+	hook := &webhook{url: "http://127.0.0.1:0", client: http.DefaultClient, c: &client{publisher: new(recordPublisher)}}
+	if _, err := hook.Write([]byte(`{}`)); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+}
+
+func TestClient_publishHandler(t *testing.T) {
+	setLog(new(writer))
+	testCases := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		count  int
+	}{
+		{"Test with GET request", http.MethodGet, "", http.StatusMethodNotAllowed, 0},
+		{"Test with one envelope", http.MethodPost, `{"topic":"a"}`, http.StatusAccepted, 1},
+		{"Test with envelopes array", http.MethodPost, `[{"topic":"a"},{"topic":"b"}]`, http.StatusAccepted, 2},
+		{"Test with bad array", http.MethodPost, `[{"topic":"a"}`, http.StatusBadRequest, 0},
+		{"Test with bad envelope", http.MethodPost, "{\"topic\":\"a\"}\n{", http.StatusBadRequest, 1},
+		{"Test with too large body", http.MethodPost, `[{"topic":"a"},{"topic":"b"},{"topic":"c"}]`, http.StatusRequestEntityTooLarge, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pub := new(recordPublisher)
+			c := &client{publisher: pub}
+			rec := httptest.NewRecorder()
+			c.publishHandler(32)(rec, httptest.NewRequest(tc.method, publishPath, strings.NewReader(tc.body)))
+			if rec.Code != tc.status {
+				t.Errorf("unexpected status: %d", rec.Code)
+			}
+			if len(pub.messages()) != tc.count {
+				t.Errorf("unexpected result: %q", pub.messages())
+			}
+		})
+	}
+}
+
+func TestClient_publishHandlerTracksReply(t *testing.T) {
+	setLog(new(writer))
+	sub := &replySubscriber{handlers: map[string]func(msg mqtt.Received){}}
+	c := &client{publisher: new(recordPublisher), rpc: newRPC(sub, new(processorWriter), time.Minute)}
+	rec := httptest.NewRecorder()
+	body := `{"topic":"svc/a/req","reply_to":"svc/b/replies","correlation_id":"1"}`
+	c.publishHandler(0)(rec, httptest.NewRequest(http.MethodPost, publishPath, strings.NewReader(body)))
+	if rec.Code != http.StatusAccepted || sub.handler("svc/b/replies") == nil {
+		t.Errorf("reply topic is not subscribed: %d, %v", rec.Code, sub.handlers)
+	}
+}
@@ -2,14 +2,13 @@ package config
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/url"
 	"os"
-	"reflect"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -27,15 +26,24 @@ const (
 	serviceHost    = "SERVICE_HOST"
 	serviceUUID    = "SERVICE_UUID"
 	serviceName    = "SERVICE_NAME"
+	bridgeOrigin   = "BRIDGE_ORIGIN"
 	serviceProcess = "SERVICE_PROCESSOR"
 
 	timeOut = time.Second * 10
 	tcp     = "tcp"
+
+	// fileSuffix is a suffix of environment with path to file holding the option value
+	fileSuffix = "_FILE"
+
+	waitMinBackoff = time.Millisecond * 500
+	waitMaxBackoff = time.Second * 10
 )
 
 var (
 	// ConfigPath represents default path to config file
 	ConfigPath = "path/to/package.json"
+	// FilePath is a path to YAML or TOML adapter config file, it is not read if empty
+	FilePath string
 	// SubscriptionsPath represents default path to subscriptions.txt file
 	SubscriptionsPath = "path/to/subscriptions.txt"
 	// Config is a container for Configuration information
@@ -54,41 +62,155 @@ type Credentials struct {
 
 // Configuration represents Configuration options
 type Configuration struct {
-	Name               string `envconfig:"SERVICE_NAME"          json:"name"`
+	Name               string `envconfig:"SERVICE_NAME"          json:"name" required:"true"`
 	UUID               string
 	Host               string
-	MQTTListenerURL    string `envconfig:"MQTT_LISTENER_URL"     default:"tcp://mqtt:1883"`
-	MQTTPublisherURL   string `envconfig:"MQTT_PUBLISHER_URL"    default:"tcp://mqtt:1883"`
-	Namespace          string `envconfig:"NAMESPACE"             default:"default"`
-	NamespaceListener  string `envconfig:"NAMESPACE_LISTENER"`
-	NamespacePublisher string `envconfig:"NAMESPACE_PUBLISHER"`
-	ServiceProcessor   string `envconfig:"SERVICE_PROCESSOR"     default:"./service-processor/processor"`
-	Topic              string
+	MQTTListenerURL    string        `envconfig:"MQTT_LISTENER_URL"     default:"tcp://mqtt:1883"`
+	MQTTPublisherURL   string        `envconfig:"MQTT_PUBLISHER_URL"    default:"tcp://mqtt:1883"`
+	Namespace          string        `envconfig:"NAMESPACE"             default:"default"`
+	NamespaceListener  string        `envconfig:"NAMESPACE_LISTENER"`
+	NamespacePublisher string        `envconfig:"NAMESPACE_PUBLISHER"`
+	ServiceProcessor   string        `envconfig:"SERVICE_PROCESSOR"     default:"./service-processor/processor"`
+	ProcessorMode      string        `envconfig:"PROCESSOR_MODE"        default:"exec"`
+	ProcessorInstances int           `envconfig:"PROCESSOR_INSTANCES"   default:"1"`
+	ProcessorHashKey   string        `envconfig:"PROCESSOR_HASH_KEY"`
+	ProcessorRestart   bool          `envconfig:"PROCESSOR_RESTART"`
+	WebhookURL         string        `envconfig:"WEBHOOK_URL"`
+	HTTPListen         string        `envconfig:"HTTP_LISTEN"           default:"127.0.0.1:8080"`
+	ProcessorSocket    string        `envconfig:"PROCESSOR_SOCKET"`
+	SocketDial         bool          `envconfig:"PROCESSOR_SOCKET_DIAL"`
+	ProcessorGRPC      string        `envconfig:"PROCESSOR_GRPC"`
+	Framing            string        `envconfig:"FRAMING"               default:"ndjson"`
+	MaxMessageSize     int           `envconfig:"MAX_MESSAGE_SIZE"      default:"16777216"`
+	QueueSize          int           `envconfig:"QUEUE_SIZE"            default:"1000"`
+	QueueOverflow      string        `envconfig:"QUEUE_OVERFLOW"        default:"block"`
+	MonitorListen      string        `envconfig:"MONITOR_LISTEN"`
+	BrokerWait         time.Duration `envconfig:"BROKER_WAIT_TIMEOUT"   default:"60s"`
+	RPCTimeout         time.Duration `envconfig:"RPC_TIMEOUT"           default:"30s"`
+	DedupeKey          string        `envconfig:"DEDUPE_KEY"`
+	DedupeTTL          time.Duration `envconfig:"DEDUPE_TTL"            default:"60s"`
+	DedupeSize         int           `envconfig:"DEDUPE_SIZE"           default:"10000"`
+	SubscriptionsPath  string        `envconfig:"SUBSCRIPTIONS_PATH"`
+	SubsReload         time.Duration `envconfig:"SUBSCRIPTIONS_RELOAD"  default:"10s"`
+	ListCredoPath      string        `envconfig:"MQTT_LISTENER_SECRET"`
+	PubCredoPath       string        `envconfig:"MQTT_PUBLISHER_SECRET"`
+	ListUser           string        `envconfig:"MQTT_LISTENER_USERNAME"`
+	ListPassword       string        `envconfig:"MQTT_LISTENER_PASSWORD" secret:"true"`
+	PubUser            string        `envconfig:"MQTT_PUBLISHER_USERNAME"`
+	PubPassword        string        `envconfig:"MQTT_PUBLISHER_PASSWORD" secret:"true"`
+	SecretsReload      time.Duration `envconfig:"SECRETS_RELOAD"        default:"60s"`
+	WSHeaders          string        `envconfig:"MQTT_WS_HEADERS"       secret:"true"`
+	WSProxy            string        `envconfig:"MQTT_WS_PROXY"`
+	TLSCA              string        `envconfig:"MQTT_TLS_CA"`
+	TLSCert            string        `envconfig:"MQTT_TLS_CERT"`
+	TLSKey             string        `envconfig:"MQTT_TLS_KEY"`
+	TLSInsecure        bool          `envconfig:"MQTT_TLS_INSECURE"`
+	Schedules          string        `envconfig:"SCHEDULES"`
+	Schemas            string        `envconfig:"SCHEMAS"`
+	DeadLetterTopic    string        `envconfig:"DEAD_LETTER_TOPIC"`
+	Topic              string        `envconfig:"SUBSCRIPTIONS"`
+	ControlACL         []string      `envconfig:"CONTROL_ACL"`
 	ListCredo          Credentials
 	PubCredo           Credentials
 	Debug              bool   `envconfig:"DEBUG"`
 	Bridge             bool   `envconfig:"BRIDGE"`
+	BridgeRules        string `envconfig:"BRIDGE_RULES"`
+	BridgeRaw          bool   `envconfig:"BRIDGE_RAW"`
+	BridgeReverse      bool   `envconfig:"BRIDGE_BIDIRECTIONAL"`
+	BridgeReverseRules string `envconfig:"BRIDGE_REVERSE_RULES"`
+	BridgeOrigin       string `envconfig:"BRIDGE_ORIGIN"`
+	BridgeFilters      string `envconfig:"BRIDGE_FILTERS"`
+	ReverseFilters     string `envconfig:"BRIDGE_REVERSE_FILTERS"`
+	BridgeTransforms   string `envconfig:"BRIDGE_TRANSFORMS"`
+	ReverseTransforms  string `envconfig:"BRIDGE_REVERSE_TRANSFORMS"`
+	BridgeDestinations string `envconfig:"BRIDGE_DESTINATIONS"`
 	Same               bool
+
+	// sources holds where option values come from by envconfig key
+	sources map[string]string
 }
 
 func (c *Configuration) setTopic() error {
-	logger.Log.Infof("Trying to read file %q ... ", SubscriptionsPath)
-	subscription, err := ioutil.ReadFile(SubscriptionsPath)
+	if c.Topic != "" {
+		logger.Log.Infof("Topic subscribed %s", c.Topic)
+		return nil
+	}
+	path := orDefault(c.SubscriptionsPath, SubscriptionsPath)
+	logger.Log.Infof("Trying to read file %q ... ", path)
+	subscription, err := ReadSubscriptions(path)
 	if err != nil {
-		msg := fmt.Sprintf("Reading Subscriptions.txt (%s) failed (err: %v).\n", SubscriptionsPath, err)
+		msg := fmt.Sprintf("Reading Subscriptions.txt (%s) failed (err: %v).\n", path, err)
 		logger.Log.Warn(msg)
 		return nil
 	}
-	c.Topic = strings.TrimSpace(string(subscription))
+	c.Topic = subscription
+	c.setSource("SUBSCRIPTIONS", path)
 	logger.Log.Infof("Topic subscribed %s", c.Topic)
 	return nil
 }
 
-// setSecrets reads secrets from json files
-func (c *Configuration) setSecrets() error {
-	c.PubCredo = getCredo(PubCredoPath)
-	c.ListCredo = getCredo(ListCredoPath)
-	return nil
+// ReadSubscriptions reads topic filters from subscriptions file, one filter per line
+func ReadSubscriptions(path string) (string, error) {
+	subscription, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(subscription)), nil
+}
+
+// SubscriptionsFile returns path of subscriptions file which may be reloaded,
+// it is empty if topic is set by SUBSCRIPTIONS option
+func (c *Configuration) SubscriptionsFile() string {
+	path := orDefault(c.SubscriptionsPath, SubscriptionsPath)
+	if source := c.Source("SUBSCRIPTIONS"); source != sourceUnset && source != path {
+		return ""
+	}
+	return path
+}
+
+// setSecrets reads credentials from JSON secret files, user info of broker URLs and
+// MQTT_*_USERNAME and MQTT_*_PASSWORD options, later sources override earlier ones
+func (c *Configuration) setSecrets() (err error) {
+	c.PubCredo, err = resolveCredo(orDefault(c.PubCredoPath, PubCredoPath), c.MQTTPublisherURL, c.PubUser, c.PubPassword)
+	if err != nil {
+		return err
+	}
+	c.ListCredo, err = resolveCredo(orDefault(c.ListCredoPath, ListCredoPath), c.MQTTListenerURL, c.ListUser, c.ListPassword)
+	return err
+}
+
+// resolveCredo merges credentials of secret file, broker URL and options, the password is redacted in logs
+func resolveCredo(filePath, brokerURL, user, password string) (Credentials, error) {
+	credo, err := getCredo(filePath)
+	if err != nil {
+		return credo, err
+	}
+	return mergeCredo(credo, brokerURL, user, password), nil
+}
+
+// mergeCredo overrides credentials with user info of broker URL and not empty user and password,
+// the password is redacted in logs
+func mergeCredo(credo Credentials, brokerURL, user, password string) Credentials {
+	if u, err := url.Parse(brokerURL); err == nil && u.User != nil {
+		credo.UserName = u.User.Username()
+		credo.Password, _ = u.User.Password()
+	}
+	if user != "" {
+		credo.UserName = user
+	}
+	if password != "" {
+		credo.Password = password
+	}
+	logger.Redact(credo.Password)
+	return credo
+}
+
+// orDefault returns value or def if value is empty
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
 }
 
 func (c *Configuration) checkOnSame() error {
@@ -107,19 +229,24 @@ func (c *Configuration) checkMQTT() bool {
 	return true
 }
 
-// getCredo reads credentials from MQTT secret files
-func getCredo(filePath string) Credentials {
+// getCredo reads credentials from MQTT secret files, missing file means no credentials
+func getCredo(filePath string) (Credentials, error) {
 	credo := new(Credentials)
 	secretFile, err := ioutil.ReadFile(filePath)
 	logger.Log.Debugf("Trying to read file %q ... ", filePath)
-	if err != nil {
+	if os.IsNotExist(err) {
 		logger.Log.Warnf("Reading MQTT Secret configuration from JSON (%s) failed (err: %v). SKIPPED.\n", filePath, err)
-		return *credo
+		return *credo, nil
+	}
+	if err != nil {
+		return *credo, fmt.Errorf("cannot read credentials: %v", err)
 	}
 	logger.Log.Debugln("OK")
 	reader := bytes.NewBuffer(secretFile)
-	json.NewDecoder(reader).Decode(credo)
-	return *credo
+	if err = json.NewDecoder(reader).Decode(credo); err != nil {
+		return Credentials{}, fmt.Errorf("cannot parse credentials %s: %v", filePath, err)
+	}
+	return *credo, nil
 }
 
 // setServiceProcessor checks if specified process exists
@@ -158,12 +285,14 @@ func (c *Configuration) setNamespace() (err error) {
 	}
 	if c.NamespaceListener == "" {
 		c.NamespaceListener = c.Namespace
+		c.setSource(nsListener, ns)
 		if err = syscall.Setenv(nsListener, c.NamespaceListener); err != nil {
 			return err
 		}
 	}
 	if c.NamespacePublisher == "" {
 		c.NamespacePublisher = c.Namespace
+		c.setSource(nsPublisher, ns)
 		if err = syscall.Setenv(nsPublisher, c.NamespacePublisher); err != nil {
 			return err
 		}
@@ -174,9 +303,6 @@ func (c *Configuration) setNamespace() (err error) {
 // setName checks if an environment SERVICE_NAME was set,
 // if no, it would set to value from package.json file
 func (c *Configuration) setName() (err error) {
-	if c.Name == "" {
-		return fmt.Errorf("SERVICE_NAME wasn't set, not from file, not from environment")
-	}
 	_, found := syscall.Getenv(serviceName)
 	if found {
 		return nil
@@ -184,26 +310,72 @@ func (c *Configuration) setName() (err error) {
 	return syscall.Setenv(serviceName, c.Name)
 }
 
+// setBridgeOrigin derives BRIDGE_ORIGIN from the service name and broker URLs if it is not set,
+// so relayed messages are recognized after the adapter restarts
+func (c *Configuration) setBridgeOrigin() (err error) {
+	if c.BridgeOrigin != "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(c.MQTTListenerURL + "\n" + c.MQTTPublisherURL))
+	c.BridgeOrigin = fmt.Sprintf("%s-%x", c.Name, sum[:4])
+	c.setSource(bridgeOrigin, serviceName)
+	return nil
+}
+
 // setURL checks if MQTT_LISTENER_URL and MQTT_PUBLISHER_URL are valid URL
 func (c *Configuration) setURL() (err error) {
-	if err = checkTCPConnection(c.MQTTPublisherURL); err != nil {
-		return err
+	if err = checkURL(c.MQTTPublisherURL); err != nil {
+		return fmt.Errorf("MQTT_PUBLISHER_URL: %v", err)
+	}
+	if err = checkURL(c.MQTTListenerURL); err != nil {
+		return fmt.Errorf("MQTT_LISTENER_URL: %v", err)
 	}
-	return checkTCPConnection(c.MQTTListenerURL)
+	return nil
 }
 
-// checkTCPConnection tries to connect to the address on the TCP network.
-func checkTCPConnection(path string) (err error) {
-	if _, err = url.Parse(path); err != nil {
+// waitForBrokers waits until MQTT brokers accept connections, BROKER_WAIT_TIMEOUT=0 disables waiting
+func (c *Configuration) waitForBrokers() error {
+	if c.BrokerWait <= 0 {
+		return nil
+	}
+	if err := c.waitForBroker(c.MQTTPublisherURL, c.BrokerWait); err != nil {
 		return err
 	}
-	dialer := net.Dialer{Timeout: timeOut}
-	con, err := dialer.Dial(tcp, strings.TrimPrefix(path, "tcp://"))
+	if c.MQTTListenerURL == c.MQTTPublisherURL {
+		return nil
+	}
+	return c.waitForBroker(c.MQTTListenerURL, c.BrokerWait)
+}
+
+// waitForBroker dials the broker, or its proxy for WebSocket URLs, on the TCP network with backoff
+// until it succeeds or timeout expires
+func (c *Configuration) waitForBroker(path string, timeout time.Duration) error {
+	address, err := c.dialAddress(path)
 	if err != nil {
 		return err
 	}
-	con.Close()
-	return nil
+	deadline := time.Now().Add(timeout)
+	backoff := waitMinBackoff
+	for {
+		dialer := net.Dialer{Timeout: timeOut, Deadline: deadline}
+		con, err := dialer.Dial(tcp, address)
+		if err == nil {
+			con.Close()
+			return nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("broker %s is not reachable within %s: %v", redactURL(path), timeout, err)
+		}
+		if backoff > remaining {
+			backoff = remaining
+		}
+		logger.Log.Warnf("Broker %s is not reachable: %v. Retry in %s", redactURL(path), err, backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > waitMaxBackoff {
+			backoff = waitMaxBackoff
+		}
+	}
 }
 
 // Load initializes Config
@@ -227,7 +399,9 @@ func (c *Configuration) checkConfig() (err error) {
 		{"setHostName", c.setHostName},
 		{"setNamespace", c.setNamespace},
 		{"setName", c.setName},
+		{"setBridgeOrigin", c.setBridgeOrigin},
 		{"setURL", c.setURL},
+		{"waitForBrokers", c.waitForBrokers},
 		{"setServiceProcess", c.setServiceProcessor},
 		{"setTopic", c.setTopic},
 		{"setSecrets", c.setSecrets},
@@ -254,28 +428,38 @@ type setList []struct {
 
 // processConfig try to load Configuration from Environment, File or by Default
 func processConfig(config *Configuration) (err error) {
-	initDefault(config)
+	if err = initDefault(config); err != nil {
+		return err
+	}
 
 	err = initJSON(config, ConfigPath)
 	if err != nil {
 		return err
 	}
-	return initEnv(config)
+	if err = initFile(config, FilePath); err != nil {
+		return err
+	}
+	if err = initEnv(config); err != nil {
+		return err
+	}
+	if err = initFlags(config); err != nil {
+		return err
+	}
+	redactSecrets(config)
+	return checkRequired(options(config))
 }
 
 // initDefault initializes Configuration by default value
 func initDefault(config *Configuration) (err error) {
-	configElements := reflect.TypeOf(config).Elem()
-	for i := 0; i < configElements.NumField(); i++ {
-		defaultValue, hasDefaultTag := configElements.Field(i).Tag.Lookup("default")
+	for _, opt := range options(config) {
+		defaultValue, hasDefaultTag := opt.tag.Lookup("default")
 		if !hasDefaultTag {
 			continue
 		}
-		field := reflect.ValueOf(config).Elem().Field(i)
-		switch field.Kind() {
-		case reflect.String:
-			field.SetString(defaultValue)
+		if err = setField(opt.field, defaultValue); err != nil {
+			return fmt.Errorf("cannot parse default value %s=%v as %s type: %v", opt.key, defaultValue, opt.field.Type(), err)
 		}
+		config.setSource(opt.key, sourceDefault)
 	}
 	return
 }
@@ -295,33 +479,49 @@ func initJSON(config *Configuration, filePath string) (err error) {
 	}
 	logger.Log.Infoln("OK")
 	reader := bytes.NewBuffer(configFileContents)
-	return json.NewDecoder(reader).Decode(config)
+	before := config.values()
+	if err = json.NewDecoder(reader).Decode(config); err != nil {
+		return err
+	}
+	for key, value := range config.values() {
+		if value != before[key] {
+			config.setSource(key, filePath)
+		}
+	}
+	return nil
 }
 
 // initEnv initializes Configuration from system environment
 func initEnv(config *Configuration) (err error) {
-	configElements := reflect.TypeOf(config).Elem()
-	for i := 0; i < configElements.NumField(); i++ {
-		envKey, hasEnvconfigTag := configElements.Field(i).Tag.Lookup("envconfig")
-		if !hasEnvconfigTag {
-			continue
-		}
-		envValue, found := syscall.Getenv(envKey)
+	for _, opt := range options(config) {
+		envValue, found := syscall.Getenv(opt.key)
+		source := sourceEnv
 		if !found {
-			continue
+			filePath, hasFile := syscall.Getenv(opt.key + fileSuffix)
+			if !hasFile {
+				continue
+			}
+			if envValue, err = readValue(filePath); err != nil {
+				return fmt.Errorf("cannot read %s%s: %v", opt.key, fileSuffix, err)
+			}
+			source = filePath
 		}
-		structFieldName := configElements.Field(i).Name
-		envField := reflect.ValueOf(config).Elem().FieldByName(structFieldName)
-		switch envField.Kind() {
-		case reflect.String:
-			envField.SetString(envValue)
-		case reflect.Bool:
-			boolEnvValue, err := strconv.ParseBool(envValue)
-			if err != nil {
-				return fmt.Errorf("cannot parse environment %s=%v as bool type", envKey, envValue)
+		if err = setField(opt.field, envValue); err != nil {
+			if isSecret(opt) {
+				envValue = logger.Redacted
 			}
-			envField.SetBool(boolEnvValue)
+			return fmt.Errorf("cannot parse environment %s=%v as %s type: %v", opt.key, envValue, opt.field.Type(), err)
 		}
+		config.setSource(opt.key, source)
 	}
 	return
 }
+
+// readValue reads option value from file, trailing new line is trimmed
+func readValue(filePath string) (string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
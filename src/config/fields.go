@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// option is a Configuration field with its envconfig key
+type option struct {
+	key   string
+	field reflect.Value
+	tag   reflect.StructTag
+}
+
+// options returns fields with envconfig key. Fields of nested structs get key of the struct as prefix,
+// e.g. field with envconfig:"URL" of struct with envconfig:"MQTT" has key MQTT_URL
+func options(config *Configuration) []option {
+	return structOptions(reflect.ValueOf(config).Elem(), "")
+}
+
+func structOptions(value reflect.Value, prefix string) []option {
+	var opts []option
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		envKey, hasEnvconfigTag := structType.Field(i).Tag.Lookup("envconfig")
+		if !hasEnvconfigTag {
+			continue
+		}
+		field := value.Field(i)
+		if field.Kind() == reflect.Struct {
+			opts = append(opts, structOptions(field, prefix+envKey+"_")...)
+			continue
+		}
+		opts = append(opts, option{key: prefix + envKey, field: field, tag: structType.Field(i).Tag})
+	}
+	return opts
+}
+
+// fieldByKey returns Configuration field with the envconfig key
+func fieldByKey(config *Configuration, key string) (reflect.Value, bool) {
+	for _, opt := range options(config) {
+		if opt.key == key {
+			return opt.field, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setField parses value by the field type and sets it.
+// Slices are comma-separated, maps are comma-separated key:value pairs
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(boolValue)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.Type() == durationType {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(duration))
+			return nil
+		}
+		intValue, err := strconv.ParseInt(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(intValue)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		uintValue, err := strconv.ParseUint(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(uintValue)
+	case reflect.Float32, reflect.Float64:
+		floatValue, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(floatValue)
+	case reflect.Slice:
+		slice := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, item := range splitList(value) {
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := setField(elem, item); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		field.Set(slice)
+	case reflect.Map:
+		m := reflect.MakeMap(field.Type())
+		for _, pair := range splitList(value) {
+			kv := strings.SplitN(pair, ":", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("%q is not a key:value pair", pair)
+			}
+			key := reflect.New(field.Type().Key()).Elem()
+			if err := setField(key, strings.TrimSpace(kv[0])); err != nil {
+				return err
+			}
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := setField(elem, strings.TrimSpace(kv[1])); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, elem)
+		}
+		field.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// splitList splits comma-separated list, empty items are skipped
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// checkRequired checks that options with required:"true" tag are set
+func checkRequired(opts []option) error {
+	for _, opt := range opts {
+		if required, _ := strconv.ParseBool(opt.tag.Get("required")); !required {
+			continue
+		}
+		unset := reflect.DeepEqual(opt.field.Interface(), reflect.Zero(opt.field.Type()).Interface())
+		if kind := opt.field.Kind(); kind == reflect.Slice || kind == reflect.Map {
+			unset = opt.field.Len() == 0
+		}
+		if unset {
+			return fmt.Errorf("required option %s is not set", opt.key)
+		}
+	}
+	return nil
+}
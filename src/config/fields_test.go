@@ -0,0 +1,105 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBroker struct {
+	URL     string        `envconfig:"URL"     required:"true"`
+	QoS     uint8         `envconfig:"QOS"     default:"1"`
+	Timeout time.Duration `envconfig:"TIMEOUT" default:"5s"`
+}
+
+type testOptions struct {
+	Listener testBroker        `envconfig:"LISTENER"`
+	Topics   []string          `envconfig:"TOPICS"`
+	Ports    []int             `envconfig:"PORTS"`
+	Labels   map[string]string `envconfig:"LABELS"`
+	Weights  map[string]int    `envconfig:"WEIGHTS"`
+	Ratio    float64           `envconfig:"RATIO"`
+	Limit    int64             `envconfig:"LIMIT"`
+	Ignored  testBroker
+	Channel  chan int `envconfig:"CHANNEL"`
+}
+
+func testOptionsOf(v *testOptions) map[string]option {
+	opts := map[string]option{}
+	for _, opt := range structOptions(reflect.ValueOf(v).Elem(), "") {
+		opts[opt.key] = opt
+	}
+	return opts
+}
+
+func TestStructOptions(t *testing.T) {
+	opts := testOptionsOf(new(testOptions))
+	for _, key := range []string{"LISTENER_URL", "LISTENER_QOS", "LISTENER_TIMEOUT", "TOPICS", "LABELS", "CHANNEL"} {
+		if _, found := opts[key]; !found {
+			t.Errorf("option %s not found", key)
+		}
+	}
+	if _, found := opts["LISTENER"]; found || len(opts) != 10 {
+		t.Errorf("unexpected options: %v", opts)
+	}
+}
+
+func TestSetField(t *testing.T) {
+	v := new(testOptions)
+	opts := testOptionsOf(v)
+	testCases := []struct {
+		name    string
+		key     string
+		value   string
+		needErr bool
+	}{
+		{"Test duration", "LISTENER_TIMEOUT", "1m30s", false},
+		{"Test not correct duration", "LISTENER_TIMEOUT", "90", true},
+		{"Test uint", "LISTENER_QOS", "2", false},
+		{"Test uint overflow", "LISTENER_QOS", "256", true},
+		{"Test float", "RATIO", "0.25", false},
+		{"Test not correct float", "RATIO", "quarter", true},
+		{"Test int64", "LIMIT", "0x10", false},
+		{"Test string slice", "TOPICS", "dev/a, dev/b,,", false},
+		{"Test int slice", "PORTS", "80,443", false},
+		{"Test not correct int slice", "PORTS", "80,https", true},
+		{"Test string map", "LABELS", "site:plant-1, line:2", false},
+		{"Test not correct map", "LABELS", "site", true},
+		{"Test not correct map value", "WEIGHTS", "a:heavy", true},
+		{"Test unsupported type", "CHANNEL", "1", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := setField(opts[tc.key].field, tc.value)
+			if (err != nil) != tc.needErr {
+				t.Errorf("unexpected result: %v", err)
+			}
+		})
+	}
+	expected := testOptions{
+		Listener: testBroker{QoS: 2, Timeout: time.Second * 90},
+		Topics:   []string{"dev/a", "dev/b"},
+		Ports:    []int{80, 443},
+		Labels:   map[string]string{"site": "plant-1", "line": "2"},
+		Ratio:    0.25,
+		Limit:    16,
+	}
+	if !reflect.DeepEqual(*v, expected) {
+		t.Errorf("unexpected result: %+v", *v)
+	}
+}
+
+func TestCheckRequired(t *testing.T) {
+	v := new(testOptions)
+	if err := checkRequired(structOptions(reflect.ValueOf(v).Elem(), "")); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+	v.Listener.URL = "tcp://mqtt:1883"
+	if err := checkRequired(structOptions(reflect.ValueOf(v).Elem(), "")); err != nil {
+		t.Error(err)
+	}
+	if err := checkRequired(options(new(Configuration))); err == nil || !strings.Contains(err.Error(), "SERVICE_NAME") {
+		t.Errorf("SERVICE_NAME is not required: %v", err)
+	}
+}
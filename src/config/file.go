@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"mqtt-adapter/src/logger"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// initFile initializes Configuration from YAML or TOML file, the format is chosen by file extension.
+// Keys are names of environment variables in any case, dashes may be used instead of underscores
+func initFile(config *Configuration, filePath string) error {
+	if filePath == "" {
+		return nil
+	}
+	logger.Log.Infof("Reading config file %q", filePath)
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %v", err)
+	}
+	options := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &options)
+	case ".toml":
+		_, err = toml.Decode(string(data), &options)
+	default:
+		return fmt.Errorf("unknown format of config file %s, expected .yaml, .yml or .toml", filePath)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse config file %s: %v", filePath, err)
+	}
+	if err = setOptions(config, filePath, "", options); err != nil {
+		return fmt.Errorf("config file %s: %v", filePath, err)
+	}
+	return nil
+}
+
+// setOptions sets fields by options of config file filePath. Nested tables set fields of nested structs
+// or maps, lists set slices. Options with null value are left unset
+func setOptions(config *Configuration, filePath, prefix string, options map[string]interface{}) error {
+	for name, value := range options {
+		if value == nil {
+			continue
+		}
+		key := prefix + optionKey(name)
+		field, found := fieldByKey(config, key)
+		table, isTable := toTable(value)
+		if !found {
+			if isTable {
+				if err := setOptions(config, filePath, key+"_", table); err != nil {
+					return err
+				}
+				continue
+			}
+			return fmt.Errorf("unknown option %q", prefix+name)
+		}
+		var err error
+		switch list := value.(type) {
+		case []interface{}:
+			err = setSlice(field, list)
+		default:
+			if isTable {
+				err = setMap(field, table)
+			} else {
+				err = setScalar(field, value)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("cannot parse %s=%v as %s type: %v", key, value, field.Type(), err)
+		}
+		config.setSource(key, filePath)
+	}
+	return nil
+}
+
+// setSlice sets slice field by list items
+func setSlice(field reflect.Value, list []interface{}) error {
+	if field.Kind() != reflect.Slice {
+		return fmt.Errorf("list is not expected")
+	}
+	slice := reflect.MakeSlice(field.Type(), 0, len(list))
+	for _, item := range list {
+		elem := reflect.New(field.Type().Elem()).Elem()
+		if err := setScalar(elem, item); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, elem)
+	}
+	field.Set(slice)
+	return nil
+}
+
+// setMap sets map field by table items
+func setMap(field reflect.Value, table map[string]interface{}) error {
+	if field.Kind() != reflect.Map {
+		return fmt.Errorf("table is not expected")
+	}
+	m := reflect.MakeMap(field.Type())
+	for name, item := range table {
+		key := reflect.New(field.Type().Key()).Elem()
+		if err := setField(key, name); err != nil {
+			return err
+		}
+		elem := reflect.New(field.Type().Elem()).Elem()
+		if err := setScalar(elem, item); err != nil {
+			return err
+		}
+		m.SetMapIndex(key, elem)
+	}
+	field.Set(m)
+	return nil
+}
+
+// setScalar sets field by YAML or TOML scalar, numbers are formatted without exponent
+func setScalar(field reflect.Value, value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return fmt.Errorf("null is not expected")
+	case string:
+		s = v
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			s = strconv.FormatInt(int64(v), 10)
+		} else {
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	case int:
+		s = strconv.Itoa(v)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case uint64:
+		s = strconv.FormatUint(v, 10)
+	case bool:
+		s = strconv.FormatBool(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+	return setField(field, s)
+}
+
+// toTable returns YAML mapping or TOML table with string keys
+func toTable(value interface{}) (map[string]interface{}, bool) {
+	switch table := value.(type) {
+	case map[string]interface{}:
+		return table, true
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for key, item := range table {
+			converted[fmt.Sprint(key)] = item
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+// optionKey returns envconfig key of config file option or command line flag
+func optionKey(name string) string {
+	return strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mqtt-adapter/src/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestInitFile(t *testing.T) {
+	logger.Log = &logrus.Logger{}
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name    string
+		file    string
+		data    string
+		needErr bool
+	}{
+		{"Test YAML", "adapter.yaml", "service_name: test\nmqtt-listener-url: tcp://broker:1883\nqueue_size: 10\ndebug: true\nsubscriptions: dev/#\n", false},
+		{"Test TOML", "adapter.toml", "SERVICE_NAME = \"test\"\nMQTT_LISTENER_URL = \"tcp://broker:1883\"\nQUEUE_SIZE = 10\nDEBUG = true\nSUBSCRIPTIONS = \"dev/#\"\n", false},
+		{"Test unknown extension", "adapter.ini", "", true},
+		{"Test unknown option", "adapter.yaml", "unknown: 1\n", true},
+		{"Test not scalar option", "adapter.yaml", "service_name:\n  - test\n", true},
+		{"Test not correct type", "adapter.toml", "QUEUE_SIZE = \"big\"\n", true},
+		{"Test not correct YAML", "adapter.yml", "service_name: [\n", true},
+		{"Test null option", "adapter.yaml", "service_name: test\nmqtt_listener_url: tcp://broker:1883\nqueue_size: 1e1\ndebug: true\nsubscriptions: dev/#\nnamespace: null\n", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.file)
+			ioutil.WriteFile(path, []byte(tc.data), 0600)
+			config := new(Configuration)
+			err := initFile(config, path)
+			if tc.needErr {
+				if err == nil {
+					t.Error("Expected not <nil> error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Name != "test" || config.MQTTListenerURL != "tcp://broker:1883" || config.QueueSize != 10 ||
+				!config.Debug || config.Topic != "dev/#" {
+				t.Errorf("unexpected result: %+v", config)
+			}
+		})
+	}
+	if err = initFile(new(Configuration), ""); err != nil {
+		t.Error(err)
+	}
+	if err = initFile(new(Configuration), filepath.Join(dir, "absent.yaml")); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+}
+
+func TestProcessConfig_precedence(t *testing.T) {
+	defer unsetEnv()
+	defer func() { FilePath, flags = "", map[string]string{} }()
+	logger.Log = &logrus.Logger{}
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	FilePath = filepath.Join(dir, "adapter.yaml")
+	ioutil.WriteFile(FilePath, []byte("namespace: file\nmqtt_listener_url: tcp://file:1883\nmqtt_publisher_url: tcp://file:1883\n"), 0600)
+	os.Unsetenv(testENV)
+	os.Setenv(serviceName, "test")
+	os.Setenv("MQTT_LISTENER_URL", "tcp://env:1883")
+	os.Setenv("MQTT_PUBLISHER_URL", "tcp://env:1883")
+	SetFlag("MQTT_PUBLISHER_URL", "tcp://flag:1883")
+	ConfigPath = ""
+
+	config := new(Configuration)
+	if err = processConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if config.QueueSize != 1000 || config.Namespace != "file" ||
+		config.MQTTListenerURL != "tcp://env:1883" || config.MQTTPublisherURL != "tcp://flag:1883" {
+		t.Errorf("unexpected result: %+v", config)
+	}
+}
+
+func TestSetSliceAndMap(t *testing.T) {
+	v := new(testOptions)
+	opts := testOptionsOf(v)
+	if err := setSlice(opts["PORTS"].field, []interface{}{80, int64(443)}); err != nil {
+		t.Error(err)
+	}
+	if err := setMap(opts["WEIGHTS"].field, map[string]interface{}{"a": 1}); err != nil {
+		t.Error(err)
+	}
+	if len(v.Ports) != 2 || v.Ports[1] != 443 || v.Weights["a"] != 1 {
+		t.Errorf("unexpected result: %+v", v)
+	}
+	if err := setSlice(opts["RATIO"].field, []interface{}{1}); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+	if err := setMap(opts["TOPICS"].field, map[string]interface{}{"a": 1}); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+	if err := setScalar(opts["LIMIT"].field, 1e7); err != nil || v.Limit != 10000000 {
+		t.Errorf("unexpected result: %d, %v", v.Limit, err)
+	}
+	if err := setScalar(opts["RATIO"].field, 1.5e-7); err != nil || v.Ratio != 1.5e-7 {
+		t.Errorf("unexpected result: %v, %v", v.Ratio, err)
+	}
+	if err := setSlice(opts["TOPICS"].field, []interface{}{"a", nil}); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+}
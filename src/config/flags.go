@@ -0,0 +1,68 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// flags holds values of command line flags by envconfig key, they override environment
+var flags = map[string]string{}
+
+// flagValue is a command line flag of Configuration field
+type flagValue struct {
+	key    string
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return flags[f.key]
+}
+
+func (f *flagValue) Set(value string) error {
+	SetFlag(f.key, value)
+	return nil
+}
+
+// IsBoolFlag allows bool flags without value
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// RegisterFlags defines a flag for every Configuration field with envconfig key,
+// e.g. -mqtt-listener-url for MQTT_LISTENER_URL
+func RegisterFlags(fs *flag.FlagSet) {
+	for _, opt := range options(new(Configuration)) {
+		value := &flagValue{key: opt.key, isBool: opt.field.Kind() == reflect.Bool}
+		fs.Var(value, flagName(opt.key), fmt.Sprintf("Overrides $%s", opt.key))
+	}
+}
+
+// SetFlag sets command line value of the option with envconfig key
+func SetFlag(key, value string) {
+	flags[key] = value
+}
+
+// initFlags initializes Configuration from command line flags
+func initFlags(config *Configuration) error {
+	for key, value := range flags {
+		field, found := fieldByKey(config, key)
+		if !found {
+			return fmt.Errorf("unknown option %s", key)
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("cannot parse flag -%s=%v as %s type: %v", flagName(key), value, field.Type(), err)
+		}
+		config.setSource(key, sourceFlag)
+	}
+	return nil
+}
+
+// flagName returns command line flag name of envconfig key
+func flagName(key string) string {
+	return strings.ToLower(strings.Replace(key, "_", "-", -1))
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"testing"
+)
+
+func TestRegisterFlags(t *testing.T) {
+	defer func() { flags = map[string]string{} }()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	RegisterFlags(fs)
+	if err := fs.Parse([]string{"-service-name", "test", "-debug", "-queue-size=10"}); err != nil {
+		t.Fatal(err)
+	}
+	config := new(Configuration)
+	if err := initFlags(config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "test" || !config.Debug || config.QueueSize != 10 {
+		t.Errorf("unexpected result: %+v", config)
+	}
+	if fs.Lookup("namespace-listener") == nil || fs.Lookup("name") != nil {
+		t.Error("unexpected flags")
+	}
+
+	SetFlag("QUEUE_SIZE", "big")
+	if err := initFlags(config); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+	flags = map[string]string{"UNKNOWN": "1"}
+	if err := initFlags(config); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+}
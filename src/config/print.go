@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mqtt-adapter/src/logger"
+)
+
+const (
+	sourceDefault = "default"
+	sourceEnv     = "environment"
+	sourceFlag    = "flag"
+	sourceUnset   = "unset"
+)
+
+// setSource remembers where value of the option comes from
+func (c *Configuration) setSource(key, source string) {
+	if c.sources == nil {
+		c.sources = map[string]string{}
+	}
+	c.sources[key] = source
+}
+
+// Source returns where value of the option comes from: default, environment, flag or path of a file
+func (c *Configuration) Source(key string) string {
+	if source, found := c.sources[key]; found {
+		return source
+	}
+	return sourceUnset
+}
+
+// values returns printable values of options by envconfig key
+func (c *Configuration) values() map[string]string {
+	values := map[string]string{}
+	for _, opt := range options(c) {
+		values[opt.key] = formatValue(opt.field)
+	}
+	return values
+}
+
+// Print writes options with their sources, secrets are redacted
+func (c *Configuration) Print(w io.Writer) error {
+	for _, opt := range options(c) {
+		value := formatValue(opt.field)
+		if isSecret(opt) && value != "" {
+			value = logger.Redacted
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s (%s)\n", opt.key, redactURL(value), c.Source(opt.key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSecret checks if the option has secret:"true" tag
+func isSecret(opt option) bool {
+	secret, _ := strconv.ParseBool(opt.tag.Get("secret"))
+	return secret
+}
+
+// redactSecrets registers values of secret options and passwords of broker URLs to be redacted in logs
+func redactSecrets(config *Configuration) {
+	for _, opt := range options(config) {
+		if isSecret(opt) {
+			logger.Redact(formatValue(opt.field))
+		}
+	}
+	if headers, err := ParseHeaders(config.WSHeaders); err == nil {
+		for _, values := range headers {
+			logger.Redact(values...)
+		}
+	}
+	for _, path := range []string{config.MQTTListenerURL, config.MQTTPublisherURL} {
+		if u, err := url.Parse(path); err == nil && u.User != nil {
+			password, _ := u.User.Password()
+			logger.Redact(password)
+		}
+	}
+}
+
+// formatValue formats value as it is set in environment
+func formatValue(field reflect.Value) string {
+	switch field.Kind() {
+	case reflect.Slice:
+		items := make([]string, field.Len())
+		for i := range items {
+			items[i] = formatValue(field.Index(i))
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		var items []string
+		for _, key := range field.MapKeys() {
+			items = append(items, formatValue(key)+":"+formatValue(field.MapIndex(key)))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(field.Interface())
+}
+
+// redactURL hides password of URL with user info
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return value
+	}
+	u.User = url.UserPassword(u.User.Username(), logger.Redacted)
+	return u.String()
+}
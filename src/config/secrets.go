@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// fromFile checks if the option value is read from its _FILE reference and returns the file path
+func (c *Configuration) fromFile(key string) (string, bool) {
+	path, found := syscall.Getenv(key + fileSuffix)
+	return path, found && c.Source(key) == path
+}
+
+// ListenerSecrets returns paths of listener credentials file, files of _FILE references except
+// MQTT_PUBLISHER_* options and TLS files, which may be rotated while the adapter runs
+func (c *Configuration) ListenerSecrets() []string {
+	return c.secretFiles(orDefault(c.ListCredoPath, ListCredoPath), "MQTT_PUBLISHER_")
+}
+
+// PublisherSecrets returns paths of publisher credentials file, files of _FILE references except
+// MQTT_LISTENER_* options and TLS files, which may be rotated while the adapter runs
+func (c *Configuration) PublisherSecrets() []string {
+	return c.secretFiles(orDefault(c.PubCredoPath, PubCredoPath), "MQTT_LISTENER_")
+}
+
+// secretFiles returns credentials file followed by files of _FILE references and TLS files,
+// options of the other client, starting with skip, are left out
+func (c *Configuration) secretFiles(credo, skip string) []string {
+	files := []string{credo}
+	for _, opt := range options(c) {
+		if path, found := c.fromFile(opt.key); found && !strings.HasPrefix(opt.key, skip) {
+			files = append(files, path)
+		}
+	}
+	for _, path := range []string{c.TLSCA, c.TLSCert, c.TLSKey} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// ResolveCredentials returns credentials of broker URL user info, user and password for connections configured
+// outside of options, e.g. bridge destinations. The password is read from passwordFile if it is empty
+func ResolveCredentials(brokerURL, user, password, passwordFile string) (Credentials, error) {
+	if password == "" && passwordFile != "" {
+		value, err := readValue(passwordFile)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("cannot read password file: %v", err)
+		}
+		password = value
+	}
+	return mergeCredo(Credentials{}, brokerURL, user, password), nil
+}
+
+// ReloadSecrets returns copy of configuration with options of _FILE references and credentials read again
+func (c *Configuration) ReloadSecrets() (*Configuration, error) {
+	next := *c
+	next.sources = map[string]string{}
+	for key, source := range c.sources {
+		next.sources[key] = source
+	}
+	for _, opt := range options(&next) {
+		path, found := next.fromFile(opt.key)
+		if !found {
+			continue
+		}
+		value, err := readValue(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s%s: %v", opt.key, fileSuffix, err)
+		}
+		if err = setField(opt.field, value); err != nil {
+			return nil, fmt.Errorf("cannot parse %s%s as %s type: %v", opt.key, fileSuffix, opt.field.Type(), err)
+		}
+	}
+	redactSecrets(&next)
+	if err := next.setSecrets(); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Resolve loads configuration without connecting to MQTT brokers: options are merged from all sources,
+// namespaces and subscriptions are resolved as Load does
+func Resolve() (*Configuration, error) {
+	config := new(Configuration)
+	if err := processConfig(config); err != nil {
+		return nil, err
+	}
+	if err := config.setNamespace(); err != nil {
+		return nil, err
+	}
+	if err := config.setTopic(); err != nil {
+		return nil, err
+	}
+	config.setBridgeOrigin()
+	return config, nil
+}
+
+// Validate checks resolved configuration, credentials and subscriptions files.
+// All found problems are returned in one error
+func (c *Configuration) Validate() error {
+	var problems []string
+	for _, broker := range []struct{ key, url string }{
+		{"MQTT_LISTENER_URL", c.MQTTListenerURL},
+		{"MQTT_PUBLISHER_URL", c.MQTTPublisherURL},
+	} {
+		if err := checkURL(broker.url); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", broker.key, err))
+		}
+	}
+	for _, path := range []string{orDefault(c.ListCredoPath, ListCredoPath), orDefault(c.PubCredoPath, PubCredoPath)} {
+		if err := checkCredo(path); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if c.WSProxy != "" {
+		if _, err := proxyAddress(c.WSProxy); err != nil {
+			problems = append(problems, fmt.Sprintf("MQTT_WS_PROXY: %v", err))
+		}
+	}
+	if _, err := ParseHeaders(c.WSHeaders); err != nil {
+		problems = append(problems, fmt.Sprintf("MQTT_WS_HEADERS: %v", err))
+	}
+	if c.Topic == "" {
+		problems = append(problems, fmt.Sprintf("topic is not set: neither SUBSCRIPTIONS nor subscriptions file %s", orDefault(c.SubscriptionsPath, SubscriptionsPath)))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// defaultPorts are MQTT ports by supported URL scheme
+var defaultPorts = map[string]string{
+	"tcp":   "1883",
+	"mqtt":  "1883",
+	"ssl":   "8883",
+	"tls":   "8883",
+	"mqtts": "8883",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// checkURL checks that broker URL has supported scheme and host or port
+func checkURL(path string) error {
+	_, err := brokerAddress(path)
+	return err
+}
+
+// brokerAddress returns host:port of broker URL, default port of the scheme is used if URL has no port
+func brokerAddress(path string) (string, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		// the error contains the URL with its password
+		return "", fmt.Errorf("not a valid URL")
+	}
+	port, supported := defaultPorts[strings.ToLower(u.Scheme)]
+	if !supported {
+		return "", fmt.Errorf("%q has unsupported scheme, expected tcp, mqtt, ssl, tls, mqtts, ws or wss", redactURL(path))
+	}
+	// empty host with port means local broker
+	if u.Hostname() == "" && u.Port() == "" {
+		return "", fmt.Errorf("%q has no host", redactURL(path))
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// checkCredo checks that credentials file is valid JSON, missing file means anonymous connection
+func checkCredo(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read credentials: %v", err)
+	}
+	var credo Credentials
+	if err = json.Unmarshal(data, &credo); err != nil {
+		return fmt.Errorf("cannot parse credentials %s: %v", path, err)
+	}
+	return nil
+}
+
+// proxyPorts are default ports of WebSocket proxies by URL scheme
+var proxyPorts = map[string]string{
+	"http":   "80",
+	"https":  "443",
+	"socks5": "1080",
+}
+
+// proxyAddress returns host:port of proxy URL
+func proxyAddress(path string) (string, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("not a valid URL")
+	}
+	port, supported := proxyPorts[strings.ToLower(u.Scheme)]
+	if !supported {
+		return "", fmt.Errorf("%q has unsupported scheme, expected http, https or socks5", redactURL(path))
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("%q has no host", redactURL(path))
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// WebsocketProxy returns proxy of WebSocket broker URL: MQTT_WS_PROXY if it is set, otherwise proxy from
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment. Nil is returned for other schemes and direct connections
+func (c *Configuration) WebsocketProxy(path string) (*url.URL, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return nil, nil
+	}
+	if c.WSProxy != "" {
+		return url.Parse(c.WSProxy)
+	}
+	return http.ProxyFromEnvironment(&http.Request{URL: u})
+}
+
+// dialAddress returns address which is dialed to reach the broker: its proxy or the broker itself
+func (c *Configuration) dialAddress(path string) (string, error) {
+	address, err := brokerAddress(path)
+	if err != nil {
+		return "", err
+	}
+	proxy, err := c.WebsocketProxy(path)
+	if err != nil || proxy == nil {
+		return address, err
+	}
+	return proxyAddress(proxy.String())
+}
+
+// ParseHeaders parses WebSocket handshake headers: JSON object of header names to a value or a list of values,
+// or comma-separated Name:value pairs when values have no commas
+func ParseHeaders(value string) (http.Header, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "{") {
+		return parseJSONHeaders(value)
+	}
+	headers := http.Header{}
+	for _, pair := range splitList(value) {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("%q is not a Name:value pair", pair)
+		}
+		headers.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+	return headers, nil
+}
+
+// parseJSONHeaders parses JSON object of WebSocket handshake headers
+func parseJSONHeaders(value string) (http.Header, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return nil, err
+	}
+	headers := http.Header{}
+	for name, raw := range fields {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("header name is empty")
+		}
+		var values []string
+		var single string
+		if err := json.Unmarshal(raw, &single); err == nil {
+			values = []string{single}
+		} else if err = json.Unmarshal(raw, &values); err != nil {
+			return nil, fmt.Errorf("header %s is not a string or a list of strings", name)
+		}
+		for _, v := range values {
+			headers.Add(strings.TrimSpace(name), v)
+		}
+	}
+	return headers, nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mqtt-adapter/src/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestResolve(t *testing.T) {
+	defer unsetEnv()
+	logger.Log = &logrus.Logger{}
+	ConfigPath = ""
+	os.Unsetenv(testENV)
+	os.Setenv(ns, "test")
+	os.Setenv(serviceName, "test")
+	os.Setenv("SUBSCRIPTIONS", "dev/#")
+	defer os.Unsetenv("SUBSCRIPTIONS")
+	config, err := Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.NamespacePublisher != "test" || config.Topic != "dev/#" || config.UUID != "" {
+		t.Errorf("unexpected result: %+v", config)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	logger.Log = &logrus.Logger{}
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	badCredo := filepath.Join(dir, "credo.json")
+	ioutil.WriteFile(badCredo, []byte("username: test"), 0600)
+
+	valid := Configuration{
+		Name:             "test",
+		MQTTListenerURL:  "tcp://mqtt:1883",
+		MQTTPublisherURL: "ssl://mqtt:8883",
+		Topic:            "dev/#",
+		ListCredoPath:    "_test.json",
+		PubCredoPath:     filepath.Join(dir, "absent.json"),
+	}
+	if err = valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := valid
+	invalid.MQTTListenerURL = "mqtt:1883"
+	invalid.PubCredoPath = badCredo
+	invalid.Topic = ""
+	invalid.SubscriptionsPath = filepath.Join(dir, "absent.txt")
+	invalid.WSProxy = "ftp://proxy"
+	invalid.WSHeaders = "token"
+	err = invalid.Validate()
+	if err == nil {
+		t.Fatal("Expected not <nil> error")
+	}
+	for _, problem := range []string{"MQTT_LISTENER_URL", "credentials", "topic", "MQTT_WS_PROXY", "MQTT_WS_HEADERS"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("%s problem is not reported: %v", problem, err)
+		}
+	}
+}
+
+func TestConfig_dialAddress(t *testing.T) {
+	testCases := []struct {
+		name     string
+		url      string
+		proxy    string
+		expected string
+		needErr  bool
+	}{
+		{"Test TCP broker with proxy", "tcp://mqtt", "http://proxy:3128", "mqtt:1883", false},
+		{"Test local WebSocket broker", "wss://localhost/mqtt", "", "localhost:443", false},
+		{"Test WebSocket broker with proxy", "ws://mqtt/mqtt", "http://proxy:3128", "proxy:3128", false},
+		{"Test SOCKS5 proxy", "wss://mqtt/mqtt", "socks5://proxy", "proxy:1080", false},
+		{"Test HTTPS proxy", "wss://mqtt/mqtt", "https://proxy", "proxy:443", false},
+		{"Test unsupported proxy", "wss://mqtt/mqtt", "ftp://proxy", "", true},
+		{"Test proxy without host", "wss://mqtt/mqtt", "http://", "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Configuration{WSProxy: tc.proxy}
+			got, err := config.dialAddress(tc.url)
+			if (err != nil) != tc.needErr || got != tc.expected {
+				t.Errorf("unexpected result: %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders("Authorization: Bearer a:b, x-site:plant-1, x-site: plant-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headers.Get("Authorization") != "Bearer a:b" || len(headers["X-Site"]) != 2 {
+		t.Errorf("unexpected result: %v", headers)
+	}
+	headers, err = ParseHeaders(`{"Accept": "text/plain, application/json", "X-Site": ["plant-1", "plant-2"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headers.Get("Accept") != "text/plain, application/json" || len(headers["X-Site"]) != 2 {
+		t.Errorf("unexpected result: %v", headers)
+	}
+	for _, value := range []string{"token", ":token", `{"X-Site": 1}`, `{"": "a"}`, `{"X-Site": "a"`} {
+		if _, err = ParseHeaders(value); err == nil {
+			t.Errorf("Expected not <nil> error for %q", value)
+		}
+	}
+}
@@ -23,4 +23,5 @@ func initLogger(){
 	customFormatter.FullTimestamp = true
 	Log = logrus.New()
 	Log.SetFormatter(customFormatter)
+	Log.AddHook(redactHook{})
 }
@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces secret values in log messages and printed configuration
+const Redacted = "REDACTED"
+
+var secrets = struct {
+	sync.RWMutex
+	values map[string]bool
+}{values: map[string]bool{}}
+
+// Redact registers secret values which are replaced in every log line, URL-escaped forms are replaced too
+func Redact(values ...string) {
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		secrets.values[value] = true
+		secrets.values[strings.TrimPrefix(url.UserPassword("", value).String(), ":")] = true
+		secrets.values[url.QueryEscape(value)] = true
+	}
+}
+
+// RedactString replaces registered secrets in s
+func RedactString(s string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	for value := range secrets.values {
+		s = strings.Replace(s, value, Redacted, -1)
+	}
+	return s
+}
+
+// redactHook replaces registered secrets in message and string fields of log entries
+type redactHook struct{}
+
+func (redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (redactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = RedactString(entry.Message)
+	for key, value := range entry.Data {
+		if s, ok := value.(string); ok {
+			entry.Data[key] = RedactString(s)
+		}
+	}
+	return nil
+}
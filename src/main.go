@@ -2,10 +2,22 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"mqtt-adapter/src/adapter"
 	"mqtt-adapter/src/config"
 	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/metrics"
+)
+
+const (
+	// cmdValidate checks configuration without connecting to MQTT brokers
+	cmdValidate = "validate"
+	// cmdPrintConfig prints effective configuration with sources of values
+	cmdPrintConfig = "print-config"
 )
 
 var (
@@ -13,10 +25,33 @@ var (
 	subsFlag   = flag.String("subs", "./service-processor/subscriptions.txt", "Path to subscriptions.txt file")
 	listFlag   = flag.String("list", "/run/secrets/mqtt_listener.json", "Path to mqtt_listener.json file")
 	pubFlag    = flag.String("pub", "/run/secrets/mqtt_publisher.json", "Path to mqtt_publisher.json file")
+	fileFlag   = flag.String("config", "", "Path to YAML or TOML adapter config file")
+
+	// pathFlags are options set by path flags when they are passed explicitly
+	pathFlags = map[string]string{
+		"subs": "SUBSCRIPTIONS_PATH",
+		"list": "MQTT_LISTENER_SECRET",
+		"pub":  "MQTT_PUBLISHER_SECRET",
+	}
 )
 
+func init() {
+	config.RegisterFlags(flag.CommandLine)
+}
+
 func main() {
-	setConfigs()
+	switch command := setConfigs(); command {
+	case "":
+	case cmdValidate, cmdPrintConfig:
+		if err := runCommand(command, os.Stdout); err != nil {
+			logger.Log.Error(err)
+			os.Exit(1)
+		}
+		return
+	default:
+		logger.Log.Errorf("Unknown command %q, expected %s or %s", command, cmdValidate, cmdPrintConfig)
+		os.Exit(2)
+	}
 
 	logger.Log.Infoln("Start MicroService MQTT adapter ...")
 	err := config.Load()
@@ -24,6 +59,7 @@ func main() {
 		logger.Log.Error(err)
 		return
 	}
+	metrics.Serve(config.Config.MonitorListen)
 	ms, err := adapter.New()
 	if err != nil {
 		logger.Log.Error(err)
@@ -33,12 +69,48 @@ func main() {
 	ms.Run()
 }
 
-// setConfigs sets paths to files from command line
-func setConfigs() {
+// runCommand runs validate or print-config command
+func runCommand(command string, out io.Writer) error {
+	conf, err := config.Resolve()
+	if err != nil {
+		return err
+	}
+	if command == cmdPrintConfig {
+		return conf.Print(out)
+	}
+	var problems []string
+	if err = conf.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err = adapter.Validate(conf); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("configuration is not valid:\n%s", strings.Join(problems, "\n"))
+	}
+	fmt.Fprintln(out, "Configuration is valid")
+	return nil
+}
+
+// setConfigs sets paths to files from command line and returns subcommand.
+// Flags may be passed before or after subcommand
+func setConfigs() string {
 	flag.Parse()
+	command := flag.Arg(0)
+	if command != "" {
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
 
 	config.ConfigPath = *configFlag
+	config.FilePath = *fileFlag
 	config.SubscriptionsPath = *subsFlag
 	config.ListCredoPath = *listFlag
 	config.PubCredoPath = *pubFlag
+	// explicit path flags override config file and environment as other flags do
+	flag.Visit(func(f *flag.Flag) {
+		if key, found := pathFlags[f.Name]; found {
+			config.SetFlag(key, f.Value.String())
+		}
+	})
+	return command
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"io"
 	"os"
 	"strings"
@@ -107,3 +108,34 @@ func getMockServer() *service.Server {
 		TopicsProvider:   "mem",         // keeps topic subscriptions in memory
 	}
 }
+
+func TestRunCommand(t *testing.T) {
+	defer func() {
+		os.Unsetenv("SERVICE_NAME")
+		os.Unsetenv("SUBSCRIPTIONS")
+		os.Unsetenv("SERVICE_PROCESSOR")
+		os.Unsetenv("NAMESPACE")
+		os.Unsetenv("NAMESPACE_LISTENER")
+		os.Unsetenv("NAMESPACE_PUBLISHER")
+	}()
+	setLog(new(writer))
+	config.ConfigPath = ""
+
+	var out bytes.Buffer
+	if err := runCommand(cmdValidate, &out); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+	os.Setenv("SERVICE_NAME", "test")
+	os.Setenv("SUBSCRIPTIONS", "dev/#")
+	os.Setenv("SERVICE_PROCESSOR", "ls -la")
+	if err := runCommand(cmdValidate, &out); err != nil {
+		t.Error(err)
+	}
+	out.Reset()
+	if err := runCommand(cmdPrintConfig, &out); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(out.String(), "SERVICE_NAME=test (environment)\n") {
+		t.Errorf("unexpected result: %s", out.String())
+	}
+}
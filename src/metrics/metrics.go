@@ -0,0 +1,30 @@
+// Package metrics publishes adapter counters and gauges with expvar
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+
+	"mqtt-adapter/src/logger"
+)
+
+// varsPath is a path of HTTP endpoint with published variables
+const varsPath = "/debug/vars"
+
+// Stats is a container for adapter counters and gauges
+var Stats = expvar.NewMap("adapter")
+
+// Serve starts HTTP server on addr exposing Stats on /debug/vars.
+// Nothing is started if addr is empty
+func Serve(addr string) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(varsPath, expvar.Handler())
+	logger.Log.Infof("Monitoring is available on %s%s", addr, varsPath)
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		logger.Log.Errorf("Monitoring server stopped: %v", err)
+	}()
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestServe(t *testing.T) {
+	logger.Log = &logrus.Logger{}
+	Serve("")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	Stats.Add("test_counter", 2)
+	Serve(addr)
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = http.Get("http://" + addr + varsPath); err == nil {
+			break
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"test_counter": 2`) {
+		t.Errorf("unexpected result: %s", body)
+	}
+}
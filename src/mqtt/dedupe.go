@@ -0,0 +1,114 @@
+package mqtt
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/logger"
+	"mqtt-adapter/src/metrics"
+
+	"github.com/eclipse/paho.mqtt.golang"
+)
+
+// dedupeHash is DEDUPE_KEY value to detect duplicates by hash of topic and the whole payload
+const dedupeHash = "hash"
+
+// deduper remembers keys of received messages within TTL window, the oldest keys are evicted if there are more than size
+type deduper struct {
+	key  string
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	now     func() time.Time
+}
+
+// dedupeEntry is a remembered key with time it was seen first
+type dedupeEntry struct {
+	key  string
+	seen time.Time
+}
+
+// newDeduper creates deduper by DEDUPE_* settings, nil is returned if DEDUPE_KEY is not set
+func newDeduper(conf *config.Configuration) *deduper {
+	if conf.DedupeKey == "" {
+		return nil
+	}
+	return &deduper{
+		key:     conf.DedupeKey,
+		ttl:     conf.DedupeTTL,
+		size:    conf.DedupeSize,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// wrap returns handler which skips duplicates
+func (d *deduper) wrap(handler mqtt.MessageHandler) mqtt.MessageHandler {
+	if d == nil {
+		return handler
+	}
+	return func(client mqtt.Client, msg mqtt.Message) {
+		if d.duplicate(msg.Topic(), msg.Payload()) {
+			metrics.Stats.Add("dedupe_dropped", 1)
+			logger.Log.Debugf("Duplicate MQTT message dropped: %s", msg.Payload())
+			return
+		}
+		handler(client, msg)
+	}
+}
+
+// duplicate checks if a message with the same key was received within the window.
+// Messages without the key are never duplicates
+func (d *deduper) duplicate(topic string, payload []byte) bool {
+	key, ok := d.keyOf(topic, payload)
+	if !ok {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	d.evict(now)
+	if _, found := d.entries[key]; found {
+		return true
+	}
+	d.entries[key] = d.order.PushBack(&dedupeEntry{key: key, seen: now})
+	for d.size > 0 && d.order.Len() > d.size {
+		d.remove(d.order.Front())
+	}
+	return false
+}
+
+// evict removes keys older than TTL
+func (d *deduper) evict(now time.Time) {
+	if d.ttl <= 0 {
+		return
+	}
+	for e := d.order.Front(); e != nil && now.Sub(e.Value.(*dedupeEntry).seen) >= d.ttl; e = d.order.Front() {
+		d.remove(e)
+	}
+}
+
+func (d *deduper) remove(e *list.Element) {
+	delete(d.entries, e.Value.(*dedupeEntry).key)
+	d.order.Remove(e)
+}
+
+// keyOf returns dedupe key of the message, the same payload on different topics has different hash
+func (d *deduper) keyOf(topic string, payload []byte) (string, bool) {
+	if d.key == dedupeHash {
+		hash := sha256.New()
+		hash.Write([]byte(topic))
+		hash.Write([]byte{0})
+		hash.Write(payload)
+		return string(hash.Sum(nil)), true
+	}
+	value, ok := LookupKey(payload, d.key)
+	return string(value), ok
+}
@@ -0,0 +1,77 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/config"
+
+	"github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestDeduper_duplicate(t *testing.T) {
+	if newDeduper(&config.Configuration{}) != nil {
+		t.Error("deduper must be disabled without DEDUPE_KEY")
+	}
+	now := time.Unix(0, 0)
+	d := newDeduper(&config.Configuration{DedupeKey: "payload.tick_uuid", DedupeTTL: 10 * time.Second, DedupeSize: 2})
+	d.now = func() time.Time { return now }
+
+	steps := []struct {
+		name      string
+		topic     string
+		msg       string
+		after     time.Duration
+		duplicate bool
+	}{
+		{"Test first message", "ticks", `{"payload":{"tick_uuid":"a"}}`, 0, false},
+		{"Test duplicate", "other", `{"topic":"other","payload":{"tick_uuid":"a"}}`, time.Second, true},
+		{"Test message without key", "ticks", `{"payload":{}}`, 0, false},
+		{"Test same message without key", "ticks", `{"payload":{}}`, 0, false},
+		{"Test not JSON", "ticks", `tick`, 0, false},
+		{"Test other key", "ticks", `{"payload":{"tick_uuid":"b"}}`, 0, false},
+		{"Test key of other type", "ticks", `{"payload":{"tick_uuid":["b"]}}`, 0, false},
+		{"Test evicted by size", "ticks", `{"payload":{"tick_uuid":"a"}}`, 0, false},
+		{"Test duplicate within TTL", "ticks", `{"payload":{"tick_uuid":"a"}}`, time.Second * 9, true},
+		{"Test expired by TTL", "ticks", `{"payload":{"tick_uuid":"a"}}`, time.Second, false},
+	}
+	for _, step := range steps {
+		now = now.Add(step.after)
+		if got := d.duplicate(step.topic, []byte(step.msg)); got != step.duplicate {
+			t.Errorf("%s: unexpected result: %v", step.name, got)
+		}
+	}
+}
+
+func TestDeduper_duplicateHash(t *testing.T) {
+	d := newDeduper(&config.Configuration{DedupeKey: dedupeHash, DedupeTTL: time.Minute})
+	if d.duplicate("a/status", []byte("on")) {
+		t.Error("first message is a duplicate")
+	}
+	if !d.duplicate("a/status", []byte("on")) {
+		t.Error("the same message on the same topic is not a duplicate")
+	}
+	if d.duplicate("b/status", []byte("on")) {
+		t.Error("the same payload on other topic is a duplicate")
+	}
+}
+
+func TestDeduper_wrap(t *testing.T) {
+	setLog(new(writer))
+	calls := 0
+	handler := func(client mqtt.Client, msg mqtt.Message) { calls++ }
+	var disabled *deduper
+	wrapped := disabled.wrap(handler)
+	wrapped(new(TestMQTTClient), TestMessage{})
+	wrapped(new(TestMQTTClient), TestMessage{})
+	if calls != 2 {
+		t.Errorf("unexpected calls: %d", calls)
+	}
+
+	wrapped = newDeduper(&config.Configuration{DedupeKey: dedupeHash, DedupeTTL: time.Minute}).wrap(handler)
+	wrapped(new(TestMQTTClient), TestMessage{})
+	wrapped(new(TestMQTTClient), TestMessage{})
+	if calls != 3 {
+		t.Errorf("unexpected calls: %d", calls)
+	}
+}
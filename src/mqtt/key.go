@@ -0,0 +1,22 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// LookupKey returns raw JSON value of dot separated key, e.g. payload.device_id
+func LookupKey(msg []byte, key string) ([]byte, bool) {
+	value := json.RawMessage(msg)
+	for _, field := range strings.Split(key, ".") {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(value, &obj); err != nil {
+			return nil, false
+		}
+		var ok bool
+		if value, ok = obj[field]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,27 @@
+package mqtt
+
+import "testing"
+
+func TestLookupKey(t *testing.T) {
+	testCases := []struct {
+		name  string
+		msg   string
+		key   string
+		found bool
+		value string
+	}{
+		{"Test top level key", `{"topic":"a"}`, "topic", true, `"a"`},
+		{"Test nested key", `{"payload":{"tick":{"uuid":1}}}`, "payload.tick.uuid", true, `1`},
+		{"Test missing key", `{"payload":{}}`, "payload.tick", false, ""},
+		{"Test not object", `{"payload":"a"}`, "payload.tick", false, ""},
+		{"Test bad JSON", `{`, "topic", false, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, found := LookupKey([]byte(tc.msg), tc.key)
+			if found != tc.found || string(value) != tc.value {
+				t.Errorf("unexpected result: %q, %v", value, found)
+			}
+		})
+	}
+}
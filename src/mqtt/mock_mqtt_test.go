@@ -18,8 +18,11 @@ type TestMQTTClient struct {
 func (t *TestMQTTClient) IsConnected() bool {
 	return true
 }
+func (t *TestMQTTClient) IsConnectionOpen() bool {
+	return true
+}
 func (t *TestMQTTClient) Connect() mqtt.Token {
-	return nil
+	return TestToken{needErr: t.needErr}
 }
 func (t *TestMQTTClient) Disconnect(quiesce uint) {}
 
@@ -36,7 +39,7 @@ func (t *TestMQTTClient) SubscribeMultiple(filters map[string]byte, callback mqt
 }
 
 func (t *TestMQTTClient) Unsubscribe(topics ...string) mqtt.Token {
-	return nil
+	return TestToken{needErr: t.needErr}
 }
 func (t *TestMQTTClient) AddRoute(topic string, callback mqtt.MessageHandler) {}
 
@@ -54,6 +57,11 @@ func (tt TestToken) Wait() bool {
 func (tt TestToken) WaitTimeout(time.Duration) bool {
 	return false
 }
+func (tt TestToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
 func (tt TestToken) Error() error {
 	if tt.needErr {
 		return errors.New("test Error")
@@ -69,6 +77,7 @@ func (m TestMessage) Retained() bool    { return false }
 func (m TestMessage) Topic() string     { return "" }
 func (m TestMessage) MessageID() uint16 { return 0 }
 func (m TestMessage) Payload() []byte   { return []byte("test") }
+func (m TestMessage) Ack()               {}
 
 type writer struct {
 	data string
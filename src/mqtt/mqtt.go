@@ -1,8 +1,13 @@
 package mqtt
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"io"
+	"io/ioutil"
 	"fmt"
+	"net/http"
+	"net/url"
 
 	"github.com/eclipse/paho.mqtt.golang"
 	"mqtt-adapter/src/config"
@@ -14,12 +19,15 @@ const qos = 0
 type Subscriber interface {
 	Subscribe(topic string, writer io.Writer)
 	SubscribeBridge(topic string, msgChan chan<- string)
+	SubscribeFunc(topic string, handler func(msg Received))
+	Unsubscribe(topic string)
 	Disconnect()
 }
 
 // Publisher is an interface that describes behavior of a publisher to MQTT
 type Publisher interface {
 	Publish(msg string) error
+	PublishRaw(topic string, payload []byte, retained bool) error
 	Disconnect()
 }
 
@@ -28,7 +36,95 @@ type Message struct {
 	Topic string `json:"topic"`
 }
 
+// Received represents a message received from MQTT broker with its metadata
+type Received struct {
+	Topic     string
+	Payload   []byte
+	QoS       byte
+	Retained  bool
+	Duplicate bool
+	MessageID uint16
+}
+
+// TLSOptions represents TLS settings of connection to MQTT broker
+type TLSOptions struct {
+	CA                 string `json:"ca"`
+	Cert               string `json:"cert"`
+	Key                string `json:"key"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// Config builds TLS config with CA and client certificate from PEM files
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CA != "" {
+		pem, err := ioutil.ReadFile(o.CA)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA: %v", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA %s", o.CA)
+		}
+	}
+	if o.Cert != "" || o.Key != "" {
+		cert, err := tls.LoadX509KeyPair(o.Cert, o.Key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %v", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
 func newClient(broker, clientID string, credo config.Credentials) (mqtt.Client, error) {
+	return newTLSClient(broker, clientID, credo, nil)
+}
+
+func newTLSClient(broker, clientID string, credo config.Credentials, tlsConf *tls.Config) (mqtt.Client, error) {
+	return newTransportClient(broker, clientID, credo, &transport{tlsConf: tlsConf})
+}
+
+// transport represents TLS and WebSocket settings of connection to MQTT broker
+type transport struct {
+	tlsConf *tls.Config
+	headers http.Header
+	proxy   *url.URL
+}
+
+// newTransport builds transport of broker connections from MQTT_TLS_* and MQTT_WS_* options
+func newTransport(conf *config.Configuration) (*transport, error) {
+	t := new(transport)
+	tlsOpts := TLSOptions{CA: conf.TLSCA, Cert: conf.TLSCert, Key: conf.TLSKey, InsecureSkipVerify: conf.TLSInsecure}
+	if tlsOpts != (TLSOptions{}) {
+		tlsConf, err := tlsOpts.Config()
+		if err != nil {
+			return nil, err
+		}
+		t.tlsConf = tlsConf
+	}
+	headers, err := config.ParseHeaders(conf.WSHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("MQTT_WS_HEADERS: %v", err)
+	}
+	if len(headers) > 0 {
+		t.headers = headers
+	}
+	if conf.WSProxy != "" {
+		if t.proxy, err = url.Parse(conf.WSProxy); err != nil {
+			return nil, fmt.Errorf("MQTT_WS_PROXY: %v", err)
+		}
+	}
+	return t, nil
+}
+
+// CheckTransport checks TLS files, WebSocket headers and proxy of broker connections
+func CheckTransport(conf *config.Configuration) error {
+	_, err := newTransport(conf)
+	return err
+}
+
+func newTransportClient(broker, clientID string, credo config.Credentials, t *transport) (mqtt.Client, error) {
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(broker)
 	opts.SetCleanSession(true)
@@ -37,6 +133,17 @@ func newClient(broker, clientID string, credo config.Credentials) (mqtt.Client,
 		opts.SetUsername(credo.UserName)
 		opts.SetPassword(credo.Password)
 	}
+	if t.tlsConf != nil {
+		opts.SetTLSConfig(t.tlsConf)
+	}
+	if t.headers != nil {
+		opts.SetHTTPHeaders(t.headers)
+	}
+	proxy := http.ProxyFromEnvironment
+	if t.proxy != nil {
+		proxy = http.ProxyURL(t.proxy)
+	}
+	opts.SetWebsocketOptions(&mqtt.WebsocketOptions{Proxy: relayProxy(proxy)})
 
 	client := mqtt.NewClient(opts)
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
@@ -45,25 +152,83 @@ func newClient(broker, clientID string, credo config.Credentials) (mqtt.Client,
 	return client, nil
 }
 
+// withoutUserInfo removes credentials from broker URL, they are resolved into Credentials by config,
+// so the client doesn't override credentials of options with them
+func withoutUserInfo(broker string) string {
+	u, err := url.Parse(broker)
+	if err != nil || u.User == nil {
+		return broker
+	}
+	u.User = nil
+	return u.String()
+}
+
+// NewPublisher creates publisher connected to the broker, tlsConf may be nil
+func NewPublisher(broker, clientID string, credo config.Credentials, tlsConf *tls.Config) (Publisher, error) {
+	client, err := newTLSClient(withoutUserInfo(broker), clientID, credo, tlsConf)
+	if err != nil {
+		return nil, err
+	}
+	return &publisher{client: client}, nil
+}
+
 // NewMQTTClients creates and initializes publisher and listener
 func NewMQTTClients(conf *config.Configuration) (pub Publisher, sub Subscriber, err error) {
+	return newClients(conf, false)
+}
+
+// NewReverseClients creates listener connected to publisher server and publisher connected to listener server
+func NewReverseClients(conf *config.Configuration) (pub Publisher, sub Subscriber, err error) {
+	return newClients(conf, true)
+}
+
+// endpoint is a broker URL with credentials and client ID of a connection
+type endpoint struct {
+	url      string
+	credo    config.Credentials
+	clientID string
+}
+
+// connect connects new client to the endpoint
+func (e endpoint) connect(t *transport) (mqtt.Client, error) {
+	return newTransportClient(withoutUserInfo(e.url), e.clientID, e.credo, t)
+}
+
+// endpoints returns listener and publisher endpoints, reverse clients swap the brokers
+func endpoints(conf *config.Configuration, reverse bool) (list, pub endpoint) {
+	list = endpoint{url: conf.MQTTListenerURL, credo: conf.ListCredo}
+	pub = endpoint{url: conf.MQTTPublisherURL, credo: conf.PubCredo}
+	suffix := ""
+	if reverse {
+		list, pub = pub, list
+		suffix = "_rev"
+	}
+	list.clientID = fmt.Sprintf("%s_%s_%s_lis%s", conf.Name, conf.Host, conf.UUID, suffix)
+	pub.clientID = fmt.Sprintf("%s_%s_%s_pub%s", conf.Name, conf.Host, conf.UUID, suffix)
+	return list, pub
+}
+
+func newClients(conf *config.Configuration, reverse bool) (pub Publisher, sub Subscriber, err error) {
 	var clS, clP mqtt.Client
-	listClientID := fmt.Sprintf("%s_%s_%s_lis", conf.Name, conf.Host, conf.UUID)
-	clS, err = newClient(conf.MQTTListenerURL, listClientID, conf.ListCredo)
+	t, err := newTransport(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	list, publish := endpoints(conf, reverse)
+	clS, err = list.connect(t)
 	if err != nil {
 		return nil, nil, err
 	}
 	if conf.Same {
-		sub = &subscriber{client: clS}
+		sub = &subscriber{client: clS, dedupe: newDeduper(conf)}
 		pub = &publisher{client: clS}
 		return pub, sub, nil
 	}
-	pubClientID := fmt.Sprintf("%s_%s_%s_pub", conf.Name, conf.Host, conf.UUID)
-	clP, err = newClient(conf.MQTTPublisherURL, pubClientID, conf.PubCredo)
+	clP, err = publish.connect(t)
 	if err != nil {
 		return nil, nil, err
 	}
-	sub = &subscriber{client: clS}
+	sub = &subscriber{client: clS, dedupe: newDeduper(conf)}
 	pub = &publisher{client: clP}
 	return pub, sub, nil
 }
@@ -0,0 +1,118 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"mqtt-adapter/src/logger"
+)
+
+// relayTimeout limits waiting for the dialer connection and its CONNECT request
+const relayTimeout = 10 * time.Second
+
+// proxyTLS is TLS configuration of connections to HTTPS proxies, system roots are used by default
+var proxyTLS = &tls.Config{}
+
+// relayProxy wraps WebSocket proxy function. The WebSocket dialer speaks only plain HTTP to a proxy and
+// MQTT client doesn't allow to replace its dialer, so an HTTPS proxy is replaced by a one-shot local relay
+// which wraps the connection in TLS. Other proxies are returned as is
+func relayProxy(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		u, err := proxy(req)
+		if err != nil || u == nil || !strings.EqualFold(u.Scheme, "https") {
+			return u, err
+		}
+		token, err := relayToken()
+		if err != nil {
+			return nil, err
+		}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		go serveRelay(listener, u, token)
+		// the dialer sends the token as proxy credentials, so only this connection is relayed
+		return &url.URL{Scheme: "http", Host: listener.Addr().String(), User: url.UserPassword("relay", token)}, nil
+	}
+}
+
+// relayToken returns random credentials of a relay
+func relayToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// serveRelay accepts one connection within relayTimeout and relays it, the listener is closed after that
+func serveRelay(listener net.Listener, proxy *url.URL, token string) {
+	listener.(*net.TCPListener).SetDeadline(time.Now().Add(relayTimeout))
+	conn, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		logger.Log.Errorf("HTTPS proxy relay of %s got no connection: %v", proxy.Host, err)
+		return
+	}
+	relay(conn, proxy, token)
+}
+
+// relay checks the relay token of CONNECT request, forwards the request with proxy credentials to the proxy
+// over TLS and copies data between the connections until one of them is closed
+func relay(conn net.Conn, proxy *url.URL, token string) {
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(relayTimeout))
+	reader := bufio.NewReader(conn)
+	req, err := http.ReadRequest(reader)
+	if err != nil || req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != basicAuth("relay", token) {
+		logger.Log.Warnf("HTTPS proxy relay of %s rejected a connection", proxy.Host)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	req.Header.Del("Proxy-Authorization")
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		req.Header.Set("Proxy-Authorization", basicAuth(proxy.User.Username(), password))
+	}
+
+	address := proxy.Host
+	if proxy.Port() == "" {
+		address = net.JoinHostPort(proxy.Hostname(), "443")
+	}
+	conf := proxyTLS.Clone()
+	conf.ServerName = proxy.Hostname()
+	upstream, err := tls.DialWithDialer(&net.Dialer{Timeout: relayTimeout}, "tcp", address, conf)
+	if err != nil {
+		logger.Log.Errorf("Cannot connect to HTTPS proxy %s: %v", address, err)
+		return
+	}
+	defer upstream.Close()
+	if err = req.Write(upstream); err != nil {
+		logger.Log.Errorf("Cannot send request to HTTPS proxy %s: %v", address, err)
+		return
+	}
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, reader)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// basicAuth returns value of Authorization header with basic credentials
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
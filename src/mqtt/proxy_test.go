@@ -0,0 +1,108 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRelayProxy(t *testing.T) {
+	logger.Log = &logrus.Logger{}
+	auth := make(chan string, 1)
+	httpsProxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth <- r.Header.Get("Proxy-Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer httpsProxy.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(httpsProxy.Certificate())
+	proxyTLS = &tls.Config{RootCAs: roots}
+	defer func() { proxyTLS = &tls.Config{} }()
+	u, _ := url.Parse(httpsProxy.URL)
+	u.User = url.UserPassword("user", "pw")
+
+	relayed := func(t *testing.T) *url.URL {
+		req, _ := http.NewRequest(http.MethodGet, "https://broker/mqtt", nil)
+		r, err := relayProxy(http.ProxyURL(u))(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Scheme != "http" || r.User == nil {
+			t.Fatalf("unexpected relay: %v", r)
+		}
+		return r
+	}
+	connect := func(t *testing.T, r *url.URL, authorization string) (*http.Response, error) {
+		conn, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(time.Second))
+		req, _ := http.NewRequest(http.MethodConnect, "http://broker:443", nil)
+		req.Host = "broker:443"
+		if authorization != "" {
+			req.Header.Set("Proxy-Authorization", authorization)
+		}
+		req.Write(conn)
+		return http.ReadResponse(bufio.NewReader(conn), req)
+	}
+
+	t.Run("Test forward credentials", func(t *testing.T) {
+		r := relayed(t)
+		token, _ := r.User.Password()
+		resp, err := connect(t, r, basicAuth("relay", token))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("unexpected status: %d", resp.StatusCode)
+		}
+		if got := <-auth; got != basicAuth("user", "pw") {
+			t.Errorf("unexpected proxy credentials: %q", got)
+		}
+		if _, err = net.Dial("tcp", r.Host); err == nil {
+			t.Error("Expected relay to be closed after one connection")
+		}
+	})
+	t.Run("Test reject without token", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		done := make(chan struct{})
+		go func() {
+			relay(server, u, "token")
+			close(done)
+		}()
+		req, _ := http.NewRequest(http.MethodConnect, "http://broker:443", nil)
+		req.Host = "broker:443"
+		req.Header.Set("Proxy-Authorization", basicAuth("user", "pw"))
+		req.Write(client)
+		if _, err := http.ReadResponse(bufio.NewReader(client), req); err == nil {
+			t.Error("Expected not <nil> error")
+		}
+		<-done
+		select {
+		case got := <-auth:
+			t.Errorf("unexpected request to proxy: %q", got)
+		default:
+		}
+	})
+	t.Run("Test other proxies", func(t *testing.T) {
+		plain, _ := url.Parse("http://proxy:3128")
+		req, _ := http.NewRequest(http.MethodGet, "ws://broker/mqtt", nil)
+		r, err := relayProxy(http.ProxyURL(plain))(req)
+		if err != nil || r != plain {
+			t.Errorf("unexpected result: %v, %v", r, err)
+		}
+	})
+}
@@ -2,6 +2,8 @@ package mqtt
 
 import (
 	"encoding/json"
+	"sync"
+
 	"mqtt-adapter/src/logger"
 
 	"github.com/eclipse/paho.mqtt.golang"
@@ -10,6 +12,8 @@ import (
 // publisher is an instance of Publisher interface
 type publisher struct {
 	client mqtt.Client
+	// mu guards client, publishes wait while it is reconnected
+	mu sync.RWMutex
 }
 
 // Publish publishes specified message to MQTT server
@@ -20,13 +24,26 @@ func (p *publisher) Publish(msg string) error {
 		return err
 	}
 	topic := m.Topic
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	token := p.client.Publish(topic, qos, false, msg)
 	token.Wait()
 	return token.Error()
 }
 
+// PublishRaw publishes payload to the topic as is
+func (p *publisher) PublishRaw(topic string, payload []byte, retained bool) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	token := p.client.Publish(topic, qos, retained, payload)
+	token.Wait()
+	return token.Error()
+}
+
 // Disconnect ends the connection with the server
 func (p *publisher) Disconnect() {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	if p.client.IsConnected() {
 		logger.Log.Infoln("MQTT Publisher disconnects from server")
 		p.client.Disconnect(250)
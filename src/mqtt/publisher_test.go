@@ -38,6 +38,18 @@ func TestPublisher_Publish(t *testing.T) {
 	}
 }
 
+func TestPublisher_PublishRaw(t *testing.T) {
+	testClient := new(TestMQTTClient)
+	pub := &publisher{client: testClient}
+	if err := pub.PublishRaw("test", []byte("not JSON"), true); err != nil {
+		t.Error(err)
+	}
+	testClient.needErr = true
+	if err := pub.PublishRaw("test", []byte("not JSON"), false); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+}
+
 func TestPublisher_Disconnect(t *testing.T) {
 	wr := new(writer)
 	setLog(wr)
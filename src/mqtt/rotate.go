@@ -0,0 +1,232 @@
+package mqtt
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/logger"
+
+	"github.com/eclipse/paho.mqtt.golang"
+	"github.com/fsnotify/fsnotify"
+)
+
+// rotation reconnects one client when fingerprint of its secret files changes
+type rotation struct {
+	name      string
+	files     []string
+	last      string
+	reconnect func(next *config.Configuration) error
+}
+
+// WatchSecrets watches credentials and TLS files of listener and publisher created by NewMQTTClients
+// or NewReverseClients (reverse) and reconnects the client whose files changed with the rotated secrets.
+// The files are also checked every SECRETS_RELOAD in case a change is not notified.
+// It returns function which stops watching and waits for a running reconnect
+func WatchSecrets(conf *config.Configuration, reverse bool, pub Publisher, sub Subscriber) func() {
+	p, isPublisher := pub.(*publisher)
+	s, isSubscriber := sub.(*subscriber)
+	if !isPublisher || !isSubscriber {
+		return func() {}
+	}
+	rotations := newRotations(conf, reverse, p, s)
+	var files []string
+	for _, r := range rotations {
+		files = append(files, r.files...)
+	}
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	closeWatcher := func() error { return nil }
+	if watcher, err := watchDirs(files); err != nil {
+		logger.Log.Warnf("Cannot watch secret files: %v", err)
+	} else {
+		events, errs, closeWatcher = watcher.Events, watcher.Errors, watcher.Close
+	}
+	var tick <-chan time.Time
+	stopTicker := func() {}
+	if conf.SecretsReload > 0 {
+		ticker := time.NewTicker(conf.SecretsReload)
+		tick, stopTicker = ticker.C, ticker.Stop
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-events:
+			case <-tick:
+			case err := <-errs:
+				logger.Log.Warnf("Cannot watch secret files: %v", err)
+				continue
+			case <-done:
+				return
+			}
+			for _, r := range rotations {
+				r.check(conf)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		stopTicker()
+		closeWatcher()
+	}
+}
+
+// newRotations returns rotation of every client, a client shared by listener and publisher is rotated once
+func newRotations(conf *config.Configuration, reverse bool, p *publisher, s *subscriber) []*rotation {
+	listFiles, pubFiles := conf.ListenerSecrets(), conf.PublisherSecrets()
+	if reverse {
+		listFiles, pubFiles = pubFiles, listFiles
+	}
+	shared := (*publisher)(nil)
+	if conf.Same {
+		shared = p
+	}
+	rotations := []*rotation{{
+		name:  "listener",
+		files: listFiles,
+		reconnect: func(next *config.Configuration) error {
+			t, err := newTransport(next)
+			if err != nil {
+				return err
+			}
+			list, _ := endpoints(next, reverse)
+			return s.reconnect(func() (mqtt.Client, error) { return list.connect(t) }, shared)
+		},
+	}}
+	if !conf.Same {
+		rotations = append(rotations, &rotation{
+			name:  "publisher",
+			files: pubFiles,
+			reconnect: func(next *config.Configuration) error {
+				t, err := newTransport(next)
+				if err != nil {
+					return err
+				}
+				_, publish := endpoints(next, reverse)
+				return p.reconnect(func() (mqtt.Client, error) { return publish.connect(t) })
+			},
+		})
+	}
+	for _, r := range rotations {
+		r.last = fingerprint(r.files)
+	}
+	return rotations
+}
+
+// check reconnects the client if its secret files changed since the last successful reconnect
+func (r *rotation) check(conf *config.Configuration) {
+	current := fingerprint(r.files)
+	if current == r.last {
+		return
+	}
+	logger.Log.Infof("Secret files of MQTT %s changed, reconnecting", r.name)
+	next, err := conf.ReloadSecrets()
+	if err == nil {
+		err = r.reconnect(next)
+	}
+	if err != nil {
+		logger.Log.Errorf("Cannot reconnect MQTT %s with rotated secrets: %v", r.name, err)
+		return
+	}
+	r.last = current
+	logger.Log.Infof("MQTT %s reconnected with rotated secrets", r.name)
+}
+
+// watchDirs watches directories of the files, so files replaced by rename or symlink swap are noticed.
+// Missing directories are skipped
+func watchDirs(files []string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	watched := map[string]bool{}
+	for _, path := range files {
+		dir := filepath.Dir(path)
+		if watched[dir] {
+			continue
+		}
+		watched[dir] = true
+		if _, err = os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		if err = watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	return watcher, nil
+}
+
+// fingerprint returns hash of files content, missing files are hashed by name
+func fingerprint(files []string) string {
+	hash := sha256.New()
+	for _, path := range files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(hash, "%s:missing\n", path)
+			continue
+		}
+		fmt.Fprintf(hash, "%s:%x\n", path, sha256.Sum256(data))
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// reconnect replaces the client with a new one and restores subscriptions on it. Publisher sharing the client
+// gets the new one too, its publishes wait only for the swap, not for the restored subscriptions
+func (s *subscriber) reconnect(connect func() (mqtt.Client, error), shared *publisher) error {
+	if shared != nil {
+		shared.mu.Lock()
+	}
+	s.mu.Lock()
+	client, err := replaceClient(s.client, connect)
+	s.client = client
+	handlers := make(map[string]mqtt.MessageHandler, len(s.handlers))
+	for topic, handler := range s.handlers {
+		handlers[topic] = handler
+	}
+	s.mu.Unlock()
+	if shared != nil {
+		shared.client = client
+		shared.mu.Unlock()
+	}
+
+	for topic, handler := range handlers {
+		if token := client.Subscribe(topic, qos, handler); token.Wait() && token.Error() != nil {
+			logger.Log.Errorf("Cannot restore subscription to %q: %v", topic, token.Error())
+		}
+	}
+	return err
+}
+
+// reconnect replaces the client with a new one, publishes wait until it is connected
+func (p *publisher) reconnect(connect func() (mqtt.Client, error)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	client, err := replaceClient(p.client, connect)
+	p.client = client
+	return err
+}
+
+// replaceClient disconnects old client and connects a new one, the same client ID can't be connected twice.
+// The old client is connected again if the new one fails
+func replaceClient(old mqtt.Client, connect func() (mqtt.Client, error)) (mqtt.Client, error) {
+	old.Disconnect(250)
+	client, err := connect()
+	if err == nil {
+		return client, nil
+	}
+	if token := old.Connect(); token.Wait() && token.Error() != nil {
+		return old, fmt.Errorf("%v, reconnect with previous secrets failed: %v", err, token.Error())
+	}
+	return old, err
+}
@@ -0,0 +1,178 @@
+package mqtt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"mqtt-adapter/src/config"
+	"mqtt-adapter/src/logger"
+
+	"github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFingerprint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mqtt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secret.json")
+	files := []string{path, filepath.Join(dir, "missing.json")}
+
+	missing := fingerprint(files)
+	ioutil.WriteFile(path, []byte(`{"password":"a"}`), 0600)
+	first := fingerprint(files)
+	if first == missing || fingerprint(files) != first {
+		t.Error("fingerprint doesn't follow file content")
+	}
+	ioutil.WriteFile(path, []byte(`{"password":"b"}`), 0600)
+	if fingerprint(files) == first {
+		t.Error("fingerprint doesn't change with file content")
+	}
+}
+
+func TestReplaceClient(t *testing.T) {
+	logger.Log = &logrus.Logger{}
+	old := &TestMQTTClient{}
+	fresh := &TestMQTTClient{}
+	client, err := replaceClient(old, func() (mqtt.Client, error) { return fresh, nil })
+	if err != nil || client != fresh {
+		t.Errorf("unexpected result: %v, %v", client, err)
+	}
+	client, err = replaceClient(old, func() (mqtt.Client, error) { return nil, errors.New("not authorized") })
+	if err == nil || client != old {
+		t.Errorf("unexpected result: %v, %v", client, err)
+	}
+	broken := &TestMQTTClient{needErr: true}
+	if _, err = replaceClient(broken, func() (mqtt.Client, error) { return nil, errors.New("not authorized") }); err == nil {
+		t.Error("Expected not <nil> error")
+	}
+}
+
+func TestWatchSecrets(t *testing.T) {
+	svr := getMockServer()
+	defer svr.Close()
+	go svr.ListenAndServe(mockURL)
+	<-time.After(time.Millisecond * 100)
+
+	logger.Log = &logrus.Logger{}
+	dir, err := ioutil.TempDir("", "mqtt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "mqtt_listener.json")
+	ioutil.WriteFile(secret, []byte(`{"username":"test","password":"first"}`), 0600)
+
+	// no polling, the change is noticed by watching the directory
+	conf := &config.Configuration{
+		Name:            "rotate",
+		MQTTListenerURL: mockURL,
+		ListCredoPath:   secret,
+		Same:            true,
+	}
+	pub, sub, err := NewMQTTClients(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Disconnect()
+	received := make(chan Received, 1)
+	sub.SubscribeFunc("rotate/#", func(msg Received) { received <- msg })
+	s, p := sub.(*subscriber), pub.(*publisher)
+	old := clientOf(&s.mu, &s.client)
+
+	stop := WatchSecrets(conf, false, pub, sub)
+	defer stop()
+	ioutil.WriteFile(secret, []byte(`{"username":"test","password":"second"}`), 0600)
+	if !swapped(&s.mu, &s.client, old) {
+		t.Fatal("listener is not reconnected")
+	}
+	if client := clientOf(&p.mu, &p.client); client == old || client != clientOf(&s.mu, &s.client) {
+		t.Fatal("publisher doesn't share the new client")
+	}
+	if old.IsConnected() {
+		t.Error("old client is not disconnected")
+	}
+
+	// subscription is restored on the new connection
+	if err = pub.Publish(`{"topic":"rotate/1"}`); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-received:
+		if msg.Topic != "rotate/1" {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+	case <-time.After(time.Second * 2):
+		t.Error("message is not received after reconnect")
+	}
+}
+
+func TestWatchSecrets_separateClients(t *testing.T) {
+	svr := getMockServer()
+	defer svr.Close()
+	go svr.ListenAndServe(mockURL)
+	<-time.After(time.Millisecond * 100)
+
+	logger.Log = &logrus.Logger{}
+	dir, err := ioutil.TempDir("", "mqtt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	listSecret := filepath.Join(dir, "mqtt_listener.json")
+	pubSecret := filepath.Join(dir, "mqtt_publisher.json")
+	ioutil.WriteFile(listSecret, []byte(`{"username":"lis","password":"first"}`), 0600)
+	ioutil.WriteFile(pubSecret, []byte(`{"username":"pub","password":"first"}`), 0600)
+
+	conf := &config.Configuration{
+		Name:             "rotate",
+		MQTTListenerURL:  mockURL,
+		MQTTPublisherURL: mockURL,
+		ListCredoPath:    listSecret,
+		PubCredoPath:     pubSecret,
+		SecretsReload:    time.Second,
+	}
+	pub, sub, err := NewMQTTClients(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Disconnect()
+	defer pub.Disconnect()
+	s, p := sub.(*subscriber), pub.(*publisher)
+	oldList, oldPub := clientOf(&s.mu, &s.client), clientOf(&p.mu, &p.client)
+
+	stop := WatchSecrets(conf, false, pub, sub)
+	ioutil.WriteFile(pubSecret, []byte(`{"username":"pub","password":"second"}`), 0600)
+	if !swapped(&p.mu, &p.client, oldPub) {
+		t.Fatal("publisher is not reconnected")
+	}
+	stop()
+	if clientOf(&s.mu, &s.client) != oldList || !oldList.IsConnected() {
+		t.Error("listener is reconnected when only publisher secrets changed")
+	}
+}
+
+// clientOf returns the client guarded by mu
+func clientOf(mu *sync.RWMutex, client *mqtt.Client) mqtt.Client {
+	mu.RLock()
+	defer mu.RUnlock()
+	return *client
+}
+
+// swapped waits until the client guarded by mu is not old
+func swapped(mu *sync.RWMutex, client *mqtt.Client, old mqtt.Client) bool {
+	for i := 0; i < 30; i++ {
+		if clientOf(mu, client) != old {
+			return true
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	return false
+}
@@ -2,7 +2,7 @@ package mqtt
 
 import (
 	"io"
-	"fmt"
+	"sync"
 	"time"
 
 	"mqtt-adapter/src/logger"
@@ -13,13 +13,19 @@ import (
 // is an instance of Subscriber interface
 type subscriber struct {
 	client mqtt.Client
+	dedupe *deduper
+	// mu guards client which is replaced on reconnect, handlers of subscribed topics are restored on the new client
+	mu       sync.RWMutex
+	handlers map[string]mqtt.MessageHandler
 }
 
 var (
 	subsHandler = func(writer io.Writer) func(client mqtt.Client, msg mqtt.Message) {
 		return func(client mqtt.Client, msg mqtt.Message) {
 			logger.Log.Debugf("MQTT_MESSAGE_RECEIVED: %s", msg.Payload())
-			fmt.Fprintln(writer, string(msg.Payload()))
+			if _, err := writer.Write(msg.Payload()); err != nil {
+				logger.Log.Warnf("Cannot pass MQTT message to processor: %v", err)
+			}
 		}
 	}
 
@@ -29,12 +35,26 @@ var (
 			msgChan <- string(msg.Payload())
 		}
 	}
+
+	subsFuncHandler = func(handler func(msg Received)) func(client mqtt.Client, msg mqtt.Message) {
+		return func(client mqtt.Client, msg mqtt.Message) {
+			logger.Log.Debugf("MQTT_MESSAGE_RECEIVED: %s", msg.Payload())
+			handler(Received{
+				Topic:     msg.Topic(),
+				Payload:   msg.Payload(),
+				QoS:       msg.Qos(),
+				Retained:  msg.Retained(),
+				Duplicate: msg.Duplicate(),
+				MessageID: msg.MessageID(),
+			})
+		}
+	}
 )
 
-// Subscribe starts a new subscription in non-bridge mode and writs received message to io.Writer
+// Subscribe starts a new subscription in non-bridge mode and writs received message to io.Writer.
+// Every message is passed to writer by a single Write call
 func (s *subscriber) Subscribe(topic string, writer io.Writer) {
-
-	if token := s.client.Subscribe(topic, qos, subsHandler(writer)); token.Wait() && token.Error() != nil {
+	if err := s.subscribe(topic, subsHandler(writer)); err != nil {
 		time.Sleep(time.Millisecond * 10)
 		return
 	}
@@ -42,14 +62,48 @@ func (s *subscriber) Subscribe(topic string, writer io.Writer) {
 
 // SubscribeBridge starts a new subscription in non-bridge mode and writs received message to specified channel
 func (s *subscriber) SubscribeBridge(topic string, msgChan chan<- string) {
-	if token := s.client.Subscribe(topic, qos, subsBridgeHandler(msgChan)); token.Wait() && token.Error() != nil {
+	if err := s.subscribe(topic, subsBridgeHandler(msgChan)); err != nil {
 		time.Sleep(time.Millisecond * 10)
 		return
 	}
 }
 
+// SubscribeFunc starts a new subscription and passes received messages with metadata to handler
+func (s *subscriber) SubscribeFunc(topic string, handler func(msg Received)) {
+	if err := s.subscribe(topic, subsFuncHandler(handler)); err != nil {
+		logger.Log.Errorf("Cannot subscribe to %q: %v", topic, err)
+	}
+}
+
+// subscribe subscribes handler to the topic and remembers it to restore subscription after reconnect
+func (s *subscriber) subscribe(topic string, handler mqtt.MessageHandler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	handler = s.dedupe.wrap(handler)
+	if token := s.client.Subscribe(topic, qos, handler); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	if s.handlers == nil {
+		s.handlers = map[string]mqtt.MessageHandler{}
+	}
+	s.handlers[topic] = handler
+	return nil
+}
+
+// Unsubscribe ends subscription to the topic
+func (s *subscriber) Unsubscribe(topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.handlers, topic)
+	if token := s.client.Unsubscribe(topic); token.Wait() && token.Error() != nil {
+		logger.Log.Errorf("Cannot unsubscribe from %q: %v", topic, token.Error())
+	}
+}
+
 // Disconnect ends the connection with the server
 func (s *subscriber) Disconnect() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if s.client.IsConnected() {
 		logger.Log.Infoln("MQTT Listener disconnects from server")
 		s.client.Disconnect(250)
@@ -80,3 +80,38 @@ func TestSubscriber_SubscribeBridge(t *testing.T) {
 		})
 	}
 }
+
+func TestSubscriber_SubscribeFunc(t *testing.T) {
+	wr := new(writer)
+	setLog(wr)
+	testClient := new(TestMQTTClient)
+	sub := &subscriber{client: testClient}
+	testClient.needErr = true
+	sub.SubscribeFunc("test", func(msg Received) {})
+	if !strings.Contains(wr.data, "Cannot subscribe") {
+		t.Errorf("unexpected result, got: %q", wr.data)
+	}
+
+	var got Received
+	handler := subsFuncHandler(func(msg Received) { got = msg })
+	handler(testClient, TestMessage{})
+	if string(got.Payload) != "test" {
+		t.Errorf("unexpected result, got: %v", got)
+	}
+}
+
+func TestSubscriber_Unsubscribe(t *testing.T) {
+	wr := new(writer)
+	setLog(wr)
+	testClient := new(TestMQTTClient)
+	sub := &subscriber{client: testClient}
+	sub.Unsubscribe("test")
+	if wr.data != "" {
+		t.Errorf("unexpected result, got: %q", wr.data)
+	}
+	testClient.needErr = true
+	sub.Unsubscribe("test")
+	if !strings.Contains(wr.data, "Cannot unsubscribe") {
+		t.Errorf("unexpected result, got: %q", wr.data)
+	}
+}
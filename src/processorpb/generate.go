@@ -0,0 +1,4 @@
+// Package processorpb holds messages and gRPC service of processor.proto generated by protoc-gen-go
+package processorpb
+
+//go:generate protoc --go_out=plugins=grpc:. processor.proto
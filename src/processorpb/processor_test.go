@@ -0,0 +1,44 @@
+package processorpb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   proto.Message
+		out  proto.Message
+	}{
+		{"Test Message", &Message{Topic: "a/b", Payload: []byte(`{}`), Qos: 1, Retained: true, Duplicate: true, MessageId: 300}, new(Message)},
+		{"Test AdapterEvent with Message", &AdapterEvent{Event: &AdapterEvent_Message{Message: &Message{Topic: "a"}}}, new(AdapterEvent)},
+		{"Test AdapterEvent with empty Ack", &AdapterEvent{Event: &AdapterEvent_Ack{Ack: &Ack{}}}, new(AdapterEvent)},
+		{"Test PublishRequest", &PublishRequest{Id: "1", Envelope: []byte(`{"topic":"a"}`)}, new(PublishRequest)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := proto.Marshal(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = proto.Unmarshal(data, tc.out); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(tc.in, tc.out) {
+				t.Errorf("unexpected result: %v, expected: %v", tc.out, tc.in)
+			}
+		})
+	}
+}
+
+func TestMarshalWireFormat(t *testing.T) {
+	// values from protoc encoded Message{topic: "a", qos: 1, message_id: 300}
+	want := []byte{0x0a, 0x01, 'a', 0x18, 0x01, 0x30, 0xac, 0x02}
+	data, _ := proto.Marshal(&Message{Topic: "a", Qos: 1, MessageId: 300})
+	if !bytes.Equal(data, want) {
+		t.Errorf("unexpected result: %x", data)
+	}
+}